@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-rstewart/go-rss/internal/database"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// minArticleLength is the shortest extracted text, in bytes, we'll accept as
+// an article. Anything shorter is more likely a teaser or navigation than
+// the body we were looking for.
+const minArticleLength = 250
+
+var (
+	positiveClassRe = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	negativeClassRe = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|sponsor|advert|share|social|related|nav|promo|header|menu|widget|popup|cookie`)
+)
+
+// unlikelyTags never hold article content.
+var unlikelyTags = map[string]bool{
+	"aside":    true,
+	"footer":   true,
+	"form":     true,
+	"header":   true,
+	"iframe":   true,
+	"nav":      true,
+	"noscript": true,
+	"script":   true,
+	"style":    true,
+	"svg":      true,
+}
+
+// startArticleExtraction extracts queued articles every interval, fetching
+// up to concurrency pages at a time. Extraction runs here rather than in the
+// scraper so slow article pages can't hold up collecting feeds.
+func (cfg *apiConfig) startArticleExtraction(concurrency int, interval time.Duration) {
+	log.Printf("Extracting articles every %s on %v goroutines...", interval, concurrency)
+	ticker := time.NewTicker(interval)
+
+	for ; ; <-ticker.C {
+		for cfg.extractQueuedArticles(context.Background(), concurrency) {
+		}
+	}
+}
+
+// extractQueuedArticles claims up to limit queued posts and extracts their
+// articles concurrently. It reports whether there may be more waiting.
+func (cfg *apiConfig) extractQueuedArticles(ctx context.Context, limit int) bool {
+	postIDs, err := cfg.DB.ClaimQueuedArticles(ctx, int32(limit))
+	if err != nil {
+		log.Println("Couldn't claim queued articles", err)
+		return false
+	}
+	if len(postIDs) == 0 {
+		return false
+	}
+	posts, err := cfg.DB.GetPostsByIDs(ctx, postIDs)
+	if err != nil {
+		log.Println("Couldn't get queued posts", err)
+		return false
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, post := range posts {
+		wg.Add(1)
+		go func(post database.Post) {
+			defer wg.Done()
+			cfg.extractFullArticle(ctx, post)
+		}(post)
+	}
+	wg.Wait()
+	return len(postIDs) == limit
+}
+
+// extractFullArticle fetches the page post links to and stores its main
+// content, replacing the post's derived text and summary with ones built
+// from the article.
+func (cfg *apiConfig) extractFullArticle(ctx context.Context, post database.Post) {
+	article, err := cfg.fetchArticle(ctx, post.Url)
+	if err != nil {
+		log.Printf("Couldn't extract article for post %s: %v", post.Url, err)
+		return
+	}
+
+	text := htmlToText(article)
+	err = cfg.DB.UpdatePostArticle(ctx, database.UpdatePostArticleParams{
+		ID:             post.ID,
+		ArticleContent: toNullString(article),
+		TextContent:    toNullString(text),
+		Summary:        toNullString(summarize(text)),
+	})
+	if err != nil {
+		log.Printf("Couldn't store article for post %s: %v", post.Url, err)
+	}
+}
+
+// fetchArticle downloads an article page and returns its main content as
+// sanitized HTML.
+func (cfg *apiConfig) fetchArticle(ctx context.Context, articleURL string) (string, error) {
+	if err := validateFeedURL(articleURL); err != nil {
+		return "", err
+	}
+	httpClient := http.Client{
+		Transport: cfg.FeedTransport,
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFeedRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFeedRedirects)
+			}
+			return validateFeedURL(req.URL.String())
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, articleURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept-Encoding", feedAcceptEncoding)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	decoded, err := decodeResponseBody(resp)
+	if err != nil {
+		return "", err
+	}
+	body, err := charset.NewReader(&maxBytesReader{r: decoded, max: cfg.MaxFeedBytes}, contentType)
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	article := extractArticle(doc)
+	if article == "" {
+		return "", fmt.Errorf("no article content found")
+	}
+	return sanitizeHTML(article, resp.Request.URL.String()), nil
+}
+
+// extractArticle finds the element of doc most likely to hold the main
+// article text and returns its inner HTML, or "" if nothing qualifies.
+//
+// It's a cut-down version of the readability heuristic: every paragraph
+// scores its parent and grandparent by how much text it has, containers are
+// nudged by their class and id, and scores are scaled down by link density
+// so navigation-heavy blocks lose out.
+func extractArticle(doc *html.Node) string {
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if unlikelyTags[n.Data] || isUnlikelyCandidate(n) {
+				return
+			}
+			if n.Data == "p" || n.Data == "pre" || n.Data == "td" {
+				scoreParagraph(n, scores, &candidates)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, candidate := range candidates {
+		score := scores[candidate] * (1 - linkDensity(candidate))
+		if best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best == nil || len(strings.TrimSpace(nodeText(best))) < minArticleLength {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	for c := best.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (unlikelyTags[c.Data] || isUnlikelyCandidate(c)) {
+			continue
+		}
+		if err := html.Render(&buf, c); err != nil {
+			return ""
+		}
+	}
+	return buf.String()
+}
+
+func scoreParagraph(p *html.Node, scores map[*html.Node]float64, candidates *[]*html.Node) {
+	text := strings.TrimSpace(nodeText(p))
+	if len(text) < 25 {
+		return
+	}
+	score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+
+	ancestors := []*html.Node{p.Parent}
+	if p.Parent != nil {
+		ancestors = append(ancestors, p.Parent.Parent)
+	}
+	for i, ancestor := range ancestors {
+		if ancestor == nil || ancestor.Type != html.ElementNode {
+			continue
+		}
+		if _, ok := scores[ancestor]; !ok {
+			scores[ancestor] = initialScore(ancestor)
+			*candidates = append(*candidates, ancestor)
+		}
+		if i == 0 {
+			scores[ancestor] += score
+		} else {
+			scores[ancestor] += score / 2
+		}
+	}
+}
+
+func initialScore(n *html.Node) float64 {
+	score := 0.0
+	switch n.Data {
+	case "article":
+		score += 10
+	case "div", "main", "section":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	classAndID := attrValue(n, "class") + " " + attrValue(n, "id")
+	if negativeClassRe.MatchString(classAndID) {
+		score -= 25
+	}
+	if positiveClassRe.MatchString(classAndID) {
+		score += 25
+	}
+	return score
+}
+
+// isUnlikelyCandidate reports whether n is obviously page furniture, such as
+// a comment section or a share bar, judging by its class and id.
+func isUnlikelyCandidate(n *html.Node) bool {
+	if n.Data == "body" || n.Data == "article" || n.Data == "main" {
+		return false
+	}
+	classAndID := attrValue(n, "class") + " " + attrValue(n, "id")
+	return negativeClassRe.MatchString(classAndID) && !positiveClassRe.MatchString(classAndID)
+}
+
+// linkDensity is the fraction of n's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	textLength := len(nodeText(n))
+	if textLength == 0 {
+		return 0
+	}
+	linkLength := 0
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			linkLength += len(nodeText(c))
+			return
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			walk(gc)
+		}
+	}
+	walk(n)
+	return float64(linkLength) / float64(textLength)
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+			return
+		}
+		if c.Type == html.ElementNode && (c.Data == "script" || c.Data == "style") {
+			return
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			walk(gc)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func readArticleFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	dat, err := os.ReadFile(filepath.Join("testdata", "articles", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dat
+}
+
+func TestExtractArticle(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "blog post",
+			file: "blog-post.html",
+			want: []string{
+				"The old scheduler had served us well",
+				"We started by measuring.",
+				"workers steal from their neighbours",
+			},
+			notWant: []string{
+				"Subscribe to our newsletter",
+				"Great post, thanks for sharing",
+				"Copyright 2024",
+				"Archive",
+				"Share",
+				"window.analytics",
+			},
+		},
+		{
+			name: "teaser too short",
+			file: "teaser.html",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(bytes.NewReader(readArticleFixture(t, tt.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := extractArticle(doc)
+			if tt.want == nil && got != "" {
+				t.Fatalf("extractArticle = %q, want nothing", got)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("article is missing %q:\n%s", s, got)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(got, s) {
+					t.Errorf("article contains %q:\n%s", s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchArticle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/post":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(readArticleFixture(t, "blog-post.html"))
+		case "/latin1":
+			w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			w.Write(readArticleFixture(t, "latin1.html"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("not really a png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &apiConfig{
+		FeedTransport: http.DefaultTransport,
+		MaxFeedBytes:  defaultMaxFeedBytes,
+	}
+
+	article, err := cfg.fetchArticle(context.Background(), server.URL+"/post")
+	if err != nil {
+		t.Fatalf("fetchArticle: %v", err)
+	}
+	if !strings.Contains(article, `href="`+server.URL+`/docs/design"`) {
+		t.Errorf("relative link wasn't resolved:\n%s", article)
+	}
+	if strings.Contains(article, "<script") {
+		t.Errorf("article wasn't sanitized:\n%s", article)
+	}
+
+	article, err = cfg.fetchArticle(context.Background(), server.URL+"/latin1")
+	if err != nil {
+		t.Fatalf("fetchArticle: %v", err)
+	}
+	if !strings.Contains(article, "Le café du coin") {
+		t.Errorf("article wasn't decoded from ISO-8859-1:\n%s", article)
+	}
+
+	if _, err := cfg.fetchArticle(context.Background(), server.URL+"/image"); err == nil {
+		t.Error("fetchArticle accepted a non-HTML page")
+	}
+	if _, err := cfg.fetchArticle(context.Background(), server.URL+"/missing"); err == nil {
+		t.Error("fetchArticle accepted a 404")
+	}
+}
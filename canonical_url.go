@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters that only identify where a click came
+// from and never change which page is served.
+var trackingParams = map[string]bool{
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"dclid":   true,
+	"fbclid":  true,
+	"gbraid":  true,
+	"gclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"mkt_tok": true,
+	"msclkid": true,
+	"ref_src": true,
+	"wbraid":  true,
+	"yclid":   true,
+}
+
+var trackingParamPrefixes = []string{"utm_", "mtm_", "pk_", "hsa_"}
+
+// redirectWrappers are link-redirect services that carry the real target in
+// a query parameter, keyed by host and path.
+var redirectWrappers = map[string]string{
+	"www.google.com/url":    "url",
+	"google.com/url":        "url",
+	"l.facebook.com/l.php":  "u",
+	"lm.facebook.com/l.php": "u",
+}
+
+// canonicalizeURL turns an item link into the form we store and compare
+// posts by: resolved against base and unwrapped from known redirectors, with
+// the scheme and host lowercased and default ports, fragments and tracking
+// parameters removed. The path and the order of the remaining query
+// parameters are kept as they are, since servers may treat them as
+// significant. Links that can't be parsed are returned trimmed but otherwise
+// untouched.
+func canonicalizeURL(rawURL, base string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if baseURL, err := url.Parse(base); err == nil && baseURL.IsAbs() {
+		u = baseURL.ResolveReference(u)
+	}
+
+	for i := 0; i < 3; i++ {
+		param, ok := redirectWrappers[strings.ToLower(u.Host)+u.Path]
+		if !ok {
+			break
+		}
+		target, err := url.Parse(u.Query().Get(param))
+		if err != nil || !target.IsAbs() {
+			break
+		}
+		u = target
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return u.String()
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.RawQuery = stripTrackingParams(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// stripTrackingParams drops tracking parameters from a raw query string,
+// leaving the others exactly as they were written.
+func stripTrackingParams(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	kept := []string{}
+	for _, param := range strings.Split(rawQuery, "&") {
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if param == "" || isTrackingParam(key) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	return strings.Join(kept, "&")
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if trackingParams[key] {
+		return true
+	}
+	for _, prefix := range trackingParamPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestCanonicalizeURL(t *testing.T) {
+	const base = "https://blog.example/posts/"
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "  ", ""},
+		{"unchanged", "https://blog.example/a/b?x=1", "https://blog.example/a/b?x=1"},
+		{"scheme and host lowercased", "HTTPS://Blog.EXAMPLE/Post/One", "https://blog.example/Post/One"},
+		{"default https port", "https://blog.example:443/a", "https://blog.example/a"},
+		{"default http port", "http://blog.example:80/a", "http://blog.example/a"},
+		{"other port kept", "https://blog.example:8443/a", "https://blog.example:8443/a"},
+		{"fragment dropped", "https://blog.example/a#comments", "https://blog.example/a"},
+		{"empty query dropped", "https://blog.example/a?", "https://blog.example/a"},
+		{"trailing slash kept", "https://blog.example/a/", "https://blog.example/a/"},
+		{"bare host kept", "https://blog.example", "https://blog.example"},
+		{"escaped path kept", "https://blog.example/a%2Fb/c%20d", "https://blog.example/a%2Fb/c%20d"},
+		{"query order kept", "https://blog.example/a?z=1&a=2&m=3", "https://blog.example/a?z=1&a=2&m=3"},
+		{"query encoding kept", "https://blog.example/a?q=a+b&r=%7E", "https://blog.example/a?q=a+b&r=%7E"},
+		{"repeated params kept", "https://blog.example/a?t=1&t=2", "https://blog.example/a?t=1&t=2"},
+		{
+			"tracking params stripped",
+			"https://blog.example/a?utm_source=rss&id=7&fbclid=abc&UTM_Medium=x&p=2",
+			"https://blog.example/a?id=7&p=2",
+		},
+		{"only tracking params", "https://blog.example/a?utm_source=rss&gclid=1", "https://blog.example/a"},
+		{"escaped tracking param", "https://blog.example/a?utm%5Fsource=rss&id=7", "https://blog.example/a?id=7"},
+		{"relative to base", "../about?ref=home", "https://blog.example/about?ref=home"},
+		{"root-relative", "/a/?utm_campaign=x", "https://blog.example/a/"},
+		{
+			"redirect wrapper unwrapped",
+			"https://www.google.com/url?q=x&url=https%3A%2F%2FNews.Example%2Fstory%3Futm_source%3Dg%26b%3D1%26a%3D2",
+			"https://news.example/story?b=1&a=2",
+		},
+		{"non-web scheme", "mailto:Ada@Example.com", "mailto:Ada@Example.com"},
+		{"unparseable", " https://blog.example/%zz ", "https://blog.example/%zz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalizeURL(tt.in, base); got != tt.want {
+				t.Errorf("canonicalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/m-rstewart/go-rss/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minClientPasswordLength is the shortest password we accept for
+// third-party clients.
+const minClientPasswordLength = 8
+
+// setClientPasswordHandler sets the password third-party reader apps log
+// in with, alongside the user's name. API keys stay the way to use our own
+// API; this exists because those apps only know how to send a username
+// and password. Names aren't unique, so only one user with a given name
+// can have a client password.
+func (cfg *apiConfig) setClientPasswordHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	if utf8.RuneCountInString(params.Password) < minClientPasswordLength {
+		respondWithError(w, http.StatusBadRequest, "Password is too short")
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't hash password")
+		return
+	}
+
+	err = cfg.DB.SetUserClientPassword(r.Context(), database.SetUserClientPasswordParams{
+		ID:                 user.ID,
+		ClientPasswordHash: sql.NullString{String: string(hash), Valid: true},
+		FeverApiKey:        sql.NullString{String: feverAPIKey(user.Name, params.Password), Valid: true},
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "users_client_login_name_key") {
+			respondWithError(w, http.StatusConflict, "Another user with this name already has a client password")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set password")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// feverAPIKey is the key Fever clients derive from a login:
+// md5("<username>:<password>") in hex.
+func feverAPIKey(username, password string) string {
+	sum := md5.Sum([]byte(username + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientItemPost turns a client API item row back into the post it was
+// read from.
+func clientItemPost(item database.GetClientItemsRow) database.Post {
+	return database.Post{
+		ID:                   item.ID,
+		CreatedAt:            item.CreatedAt,
+		UpdatedAt:            item.UpdatedAt,
+		Title:                item.Title,
+		Url:                  item.Url,
+		Description:          item.Description,
+		PublishedAt:          item.PublishedAt,
+		FeedID:               item.FeedID,
+		Content:              item.Content,
+		Authors:              item.Authors,
+		Categories:           item.Categories,
+		CommentsUrl:          item.CommentsUrl,
+		ThumbnailUrl:         item.ThumbnailUrl,
+		SanitizedDescription: item.SanitizedDescription,
+		SanitizedContent:     item.SanitizedContent,
+		TextContent:          item.TextContent,
+		Summary:              item.Summary,
+		ArticleContent:       item.ArticleContent,
+		ClusterID:            item.ClusterID,
+		Seq:                  item.Seq,
+	}
+}
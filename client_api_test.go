@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+func TestSetClientPasswordConflicts(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "name taken",
+			err:        errors.New(`pq: duplicate key value violates unique constraint "users_client_login_name_key"`),
+			wantStatus: http.StatusConflict,
+			wantError:  "Another user with this name already has a client password",
+		},
+		{
+			// Names are unique among client logins, so this is an md5
+			// collision. Saying so would tell the user someone else's
+			// password.
+			name:       "fever key taken",
+			err:        errors.New(`pq: duplicate key value violates unique constraint "users_fever_api_key_key"`),
+			wantStatus: http.StatusInternalServerError,
+			wantError:  "Couldn't set password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			user := database.User{ID: uuid.New(), Name: "ada"}
+			mock.ExpectExec(query("SetUserClientPassword")).
+				WithArgs(user.ID, sqlmock.AnyArg(), feverAPIKey("ada", "correct horse")).
+				WillReturnError(tt.err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/v1/users/client_password", bytes.NewBufferString(`{"password":"correct horse"}`))
+			cfg.setClientPasswordHandler(w, r, user)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("body = %s, want error %q", w.Body, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// collectionFeedLimit is how many posts a public collection feed carries.
+const collectionFeedLimit = 100
+
+// collectionCacheControl lets shared caches hold a public collection feed
+// for a few minutes.
+const collectionCacheControl = "public, max-age=300"
+
+var (
+	slugInvalidRe = regexp.MustCompile(`[^a-z0-9]+`)
+	slugValidRe   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+type Collection struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uuid.UUID `json:"user_id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description *string   `json:"description"`
+}
+
+func databaseCollectionToCollection(collection database.Collection) Collection {
+	return Collection{
+		ID:          collection.ID,
+		CreatedAt:   collection.CreatedAt,
+		UpdatedAt:   collection.UpdatedAt,
+		UserID:      collection.UserID,
+		Name:        collection.Name,
+		Slug:        collection.Slug,
+		Description: nullStringPtr(collection.Description),
+	}
+}
+
+func (cfg *apiConfig) createCollectionHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name        string `json:"name"`
+		Slug        string `json:"slug"`
+		Description string `json:"description"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		respondWithError(w, http.StatusBadRequest, "Collection name is required")
+		return
+	}
+	slug := params.Slug
+	if slug == "" {
+		slug = slugify(name)
+	}
+	if !slugValidRe.MatchString(slug) {
+		respondWithError(w, http.StatusBadRequest, "Slug may only contain lowercase letters, digits and dashes")
+		return
+	}
+
+	collection, err := cfg.DB.CreateCollection(r.Context(), database.CreateCollectionParams{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		UserID:      user.ID,
+		Name:        name,
+		Slug:        slug,
+		Description: toNullString(params.Description),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			respondWithError(w, http.StatusConflict, "Slug is already taken")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create collection")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseCollectionToCollection(collection))
+}
+
+func (cfg *apiConfig) getCollectionsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	collections, err := cfg.DB.GetCollectionsByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get collections")
+		return
+	}
+
+	res := make([]Collection, 0, len(collections))
+	for _, collection := range collections {
+		res = append(res, databaseCollectionToCollection(collection))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) deleteCollectionHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	collectionID, err := uuid.Parse(chi.URLParam(r, "collectionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return
+	}
+
+	err = cfg.DB.DeleteCollection(r.Context(), database.DeleteCollectionParams{
+		ID:     collectionID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Collection could not be deleted")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (cfg *apiConfig) addCollectionPostHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		PostID uuid.UUID `json:"post_id"`
+	}
+
+	collection, ok := cfg.collectionFromRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	// Collections are public, so only posts from feeds the user follows can
+	// go in them.
+	_, err = cfg.DB.GetFollowedPost(r.Context(), database.GetFollowedPostParams{
+		ID:     params.PostID,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get post")
+		return
+	}
+
+	err = cfg.DB.AddPostToCollection(r.Context(), database.AddPostToCollectionParams{
+		CollectionID: collection.ID,
+		PostID:       params.PostID,
+		AddedAt:      time.Now().UTC(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add post to collection")
+		return
+	}
+	// Bump the collection so its feed's Last-Modified moves even when the
+	// post itself is old.
+	err = cfg.DB.TouchCollection(r.Context(), collection.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update collection")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, struct{}{})
+}
+
+func (cfg *apiConfig) removeCollectionPostHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	collection, ok := cfg.collectionFromRequest(w, r, user)
+	if !ok {
+		return
+	}
+	postID, err := uuid.Parse(chi.URLParam(r, "postID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	err = cfg.DB.RemovePostFromCollection(r.Context(), database.RemovePostFromCollectionParams{
+		CollectionID: collection.ID,
+		PostID:       postID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove post from collection")
+		return
+	}
+	err = cfg.DB.TouchCollection(r.Context(), collection.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update collection")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// collectionFromRequest loads the collection named in the URL, writing an
+// error response and returning false unless it belongs to user.
+func (cfg *apiConfig) collectionFromRequest(w http.ResponseWriter, r *http.Request, user database.User) (database.Collection, bool) {
+	collectionID, err := uuid.Parse(chi.URLParam(r, "collectionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return database.Collection{}, false
+	}
+	collection, err := cfg.DB.GetCollectionForUser(r.Context(), database.GetCollectionForUserParams{
+		ID:     collectionID,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Collection not found")
+		return database.Collection{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get collection")
+		return database.Collection{}, false
+	}
+	return collection, true
+}
+
+func (cfg *apiConfig) getSharedCollectionRSSHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.serveCollection(w, r, "application/rss+xml; charset=utf-8", renderRSS)
+}
+
+func (cfg *apiConfig) getSharedCollectionAtomHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.serveCollection(w, r, "application/atom+xml; charset=utf-8", renderAtom)
+}
+
+func (cfg *apiConfig) getSharedCollectionJSONHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.serveCollection(w, r, "application/feed+json; charset=utf-8", renderJSONFeed)
+}
+
+// serveCollection renders a collection by its public slug. Anyone with the
+// slug can read it; that's the point of sharing one.
+func (cfg *apiConfig) serveCollection(w http.ResponseWriter, r *http.Request, contentType string, render func(outputFeed) ([]byte, error)) {
+	collection, err := cfg.DB.GetCollectionBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get collection")
+		return
+	}
+
+	posts, err := cfg.DB.GetCollectionPosts(r.Context(), database.GetCollectionPostsParams{
+		CollectionID: collection.ID,
+		Limit:        collectionFeedLimit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get posts")
+		return
+	}
+
+	feed := newOutputFeed(
+		"urn:uuid:"+collection.ID.String(),
+		collection.Name,
+		collection.Description.String,
+		requestURL(r),
+		"",
+		posts,
+	)
+	if collection.UpdatedAt.After(feed.Updated) {
+		feed.Updated = collection.UpdatedAt
+	}
+	body, err := render(feed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't render feed")
+		return
+	}
+	serveFeedDocument(w, r, contentType, collectionCacheControl, body, feed.Updated)
+}
+
+// slugify turns a collection name into a URL-safe slug.
+func slugify(name string) string {
+	return strings.Trim(slugInvalidRe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
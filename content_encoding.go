@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// feedAcceptEncoding is sent with every feed request. Setting it ourselves
+// turns off the transport's transparent gzip handling, so responses have to
+// go through decodeResponseBody.
+const feedAcceptEncoding = "br, gzip, deflate"
+
+// decodeResponseBody returns the body of resp with its Content-Encoding
+// removed.
+func decodeResponseBody(resp *http.Response) (io.Reader, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "br":
+		return brotli.NewReader(resp.Body), nil
+	case "deflate":
+		// "deflate" is meant to be zlib-wrapped, but some servers send a raw
+		// deflate stream instead. A zlib stream's first two bytes form a
+		// header that's a multiple of 31, which raw deflate rarely matches.
+		br := bufio.NewReader(resp.Body)
+		header, err := br.Peek(2)
+		if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// newResponseCompressor compresses API responses for clients that accept
+// it, preferring brotli over gzip and deflate.
+func newResponseCompressor() func(http.Handler) http.Handler {
+	compressor := middleware.NewCompressor(5, "application/json", "application/atom+xml", "application/rss+xml", "application/feed+json")
+	compressor.SetEncoder("br", func(w io.Writer, level int) io.Writer {
+		return brotli.NewWriterLevel(w, level)
+	})
+	return compressor.Handler
+}
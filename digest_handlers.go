@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// digestSendCooldown is how long after a digest went out before one can be
+// sent on demand.
+const digestSendCooldown = 15 * time.Minute
+
+type DigestSettings struct {
+	Email         string      `json:"email"`
+	EmailVerified bool        `json:"email_verified"`
+	Frequency     string      `json:"frequency"`
+	SendHour      int32       `json:"send_hour"`
+	Weekday       int32       `json:"weekday"`
+	FeedIDs       []uuid.UUID `json:"feed_ids"`
+	Enabled       bool        `json:"enabled"`
+	LastSentAt    *time.Time  `json:"last_sent_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+func databaseDigestSettingsToDigestSettings(setting database.DigestSetting) DigestSettings {
+	feedIDs := setting.FeedIds
+	if feedIDs == nil {
+		feedIDs = []uuid.UUID{}
+	}
+	return DigestSettings{
+		Email:         setting.Email,
+		EmailVerified: setting.EmailVerifiedAt.Valid,
+		Frequency:     setting.Frequency,
+		SendHour:      setting.SendHour,
+		Weekday:       setting.Weekday,
+		FeedIDs:       feedIDs,
+		Enabled:       setting.Enabled,
+		LastSentAt:    nullTimePtr(setting.LastSentAt),
+		UpdatedAt:     setting.UpdatedAt,
+	}
+}
+
+func (cfg *apiConfig) getDigestSettingsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	setting, err := cfg.DB.GetDigestSettings(r.Context(), user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "No digest configured")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get digest settings")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseDigestSettingsToDigestSettings(setting))
+}
+
+// updateDigestSettingsHandler creates or replaces the user's digest
+// settings. send_hour is in UTC; weekday (0 is Sunday) only matters for
+// weekly digests. An empty feed_ids includes every followed feed. Nothing is
+// sent to the address until the user follows the confirmation link we email
+// it, and changing the address needs it confirmed again.
+func (cfg *apiConfig) updateDigestSettingsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Email     string      `json:"email"`
+		Frequency string      `json:"frequency"`
+		SendHour  int32       `json:"send_hour"`
+		Weekday   int32       `json:"weekday"`
+		FeedIDs   []uuid.UUID `json:"feed_ids"`
+		Enabled   *bool       `json:"enabled"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	if cfg.Mailer == nil || cfg.PublicBaseURL == "" {
+		respondWithError(w, http.StatusServiceUnavailable, "Email isn't configured on this server")
+		return
+	}
+	address, err := mail.ParseAddress(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email")
+		return
+	}
+	if params.Frequency == "" {
+		params.Frequency = digestDaily
+	}
+	if params.Frequency != digestDaily && params.Frequency != digestWeekly {
+		respondWithError(w, http.StatusBadRequest, "Frequency must be daily or weekly")
+		return
+	}
+	if params.SendHour < 0 || params.SendHour > 23 {
+		respondWithError(w, http.StatusBadRequest, "send_hour must be between 0 and 23")
+		return
+	}
+	if params.Weekday < 0 || params.Weekday > 6 {
+		respondWithError(w, http.StatusBadRequest, "weekday must be between 0 and 6")
+		return
+	}
+	if params.FeedIDs == nil {
+		params.FeedIDs = []uuid.UUID{}
+	}
+	if len(params.FeedIDs) > 0 {
+		followed, err := cfg.followedFeedIDs(r, user)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get feed follows")
+			return
+		}
+		for _, id := range params.FeedIDs {
+			if !followed[id] {
+				respondWithError(w, http.StatusBadRequest, "feed_ids must be feeds you follow")
+				return
+			}
+		}
+	}
+	enabled := true
+	if params.Enabled != nil {
+		enabled = *params.Enabled
+	}
+	// Only used if the address still needs confirming.
+	token, err := newSecretToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create confirmation token")
+		return
+	}
+
+	setting, err := cfg.DB.UpsertDigestSettings(r.Context(), database.UpsertDigestSettingsParams{
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Email:     address.Address,
+		Frequency: params.Frequency,
+		SendHour:  params.SendHour,
+		Weekday:   params.Weekday,
+		FeedIds:   params.FeedIDs,
+		Enabled:   enabled,
+		VerificationToken: sql.NullString{
+			String: token,
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save digest settings")
+		return
+	}
+
+	if !setting.EmailVerifiedAt.Valid {
+		msg, err := cfg.digestConfirmationEmail(user, setting)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create confirmation email")
+			return
+		}
+		if err := cfg.Mailer.send(msg); err != nil {
+			log.Printf("Couldn't send digest confirmation to %s: %v", setting.Email, err)
+			respondWithError(w, http.StatusBadGateway, "Couldn't send confirmation email")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseDigestSettingsToDigestSettings(setting))
+}
+
+func (cfg *apiConfig) deleteDigestSettingsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	err := cfg.DB.DeleteDigestSettings(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Digest settings could not be deleted")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// sendDigestHandler sends the user's digest now rather than waiting for
+// its scheduled time.
+func (cfg *apiConfig) sendDigestHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	if cfg.Mailer == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Email isn't configured on this server")
+		return
+	}
+	setting, err := cfg.DB.GetDigestSettings(r.Context(), user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "No digest configured")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get digest settings")
+		return
+	}
+
+	if !setting.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Confirm your email address first")
+		return
+	}
+	now := time.Now().UTC()
+	if setting.LastSentAt.Valid && now.Sub(setting.LastSentAt.Time) < digestSendCooldown {
+		respondWithError(w, http.StatusTooManyRequests, "A digest was sent recently, try again later")
+		return
+	}
+
+	err = cfg.sendDigest(r.Context(), setting, now)
+	if err != nil {
+		log.Printf("Couldn't send digest to %s: %v", setting.Email, err)
+		respondWithError(w, http.StatusBadGateway, "Couldn't send digest")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// verifyDigestEmailHandler confirms a digest address from the link in the
+// confirmation email. It's opened in a browser, so it answers in plain text.
+func (cfg *apiConfig) verifyDigestEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithText(w, http.StatusBadRequest, "This confirmation link is incomplete.")
+		return
+	}
+	verified, err := cfg.DB.VerifyDigestEmail(r.Context(), sql.NullString{String: token, Valid: true})
+	if err != nil {
+		log.Printf("Couldn't verify digest email: %v", err)
+		respondWithText(w, http.StatusInternalServerError, "Couldn't confirm your email address, please try again.")
+		return
+	}
+	if verified == 0 {
+		respondWithText(w, http.StatusNotFound, "This confirmation link is invalid or has already been used.")
+		return
+	}
+
+	respondWithText(w, http.StatusOK, "Your email address is confirmed. Digests will now be sent to it.")
+}
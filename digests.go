@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// Digest frequencies.
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// maxDigestPosts caps how many posts one digest lists.
+const maxDigestPosts = 200
+
+// digestFeed is a feed's section of a digest.
+type digestFeed struct {
+	Name  string
+	Posts []digestPost
+}
+
+type digestPost struct {
+	Title   string
+	Url     string
+	Summary string
+}
+
+type digestData struct {
+	Name  string
+	Count int
+	Feeds []digestFeed
+}
+
+var digestTextTemplate = texttemplate.Must(texttemplate.New("digest").Parse(
+	`Hi {{.Name}}, here are {{.Count}} unread posts.
+{{range .Feeds}}
+== {{.Name}} ==
+{{range .Posts}}
+* {{.Title}}
+  {{.Url}}
+{{- if .Summary}}
+  {{.Summary}}
+{{- end}}
+{{end}}{{end}}`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Parse(
+	`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; max-width: 40em;">
+<p>Hi {{.Name}}, here are {{.Count}} unread posts.</p>
+{{range .Feeds}}
+<h2>{{.Name}}</h2>
+<ul>
+{{range .Posts}}<li>
+<a href="{{.Url}}">{{.Title}}</a>
+{{if .Summary}}<p>{{.Summary}}</p>{{end}}
+</li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+var digestConfirmationTextTemplate = texttemplate.Must(texttemplate.New("confirmation").Parse(
+	`Hi {{.Name}}, please confirm that digests should be sent to this address:
+
+{{.Link}}
+
+If you didn't ask for digests, ignore this email and you won't get any.
+`))
+
+var digestConfirmationHTMLTemplate = htmltemplate.Must(htmltemplate.New("confirmation").Parse(
+	`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; max-width: 40em;">
+<p>Hi {{.Name}}, please confirm that digests should be sent to this address:</p>
+<p><a href="{{.Link}}">Confirm this address</a></p>
+<p>If you didn't ask for digests, ignore this email and you won't get any.</p>
+</body>
+</html>
+`))
+
+// startDigests sends digests that have come due every interval.
+func (cfg *apiConfig) startDigests(interval time.Duration) {
+	log.Printf("Checking for due digests every %s...", interval)
+	ticker := time.NewTicker(interval)
+
+	for ; ; <-ticker.C {
+		settings, err := cfg.DB.GetEnabledDigestSettings(context.Background())
+		if err != nil {
+			log.Println("Couldn't get digest settings", err)
+			continue
+		}
+		now := time.Now().UTC()
+		for _, setting := range settings {
+			if !digestDue(setting, now) {
+				continue
+			}
+			if err := cfg.sendDigest(context.Background(), setting, now); err != nil {
+				log.Printf("Couldn't send digest to %s: %v", setting.Email, err)
+			}
+		}
+	}
+}
+
+// digestScheduledAt returns the most recent time at or before now that a
+// digest with these settings was due. Times are in UTC.
+func digestScheduledAt(setting database.DigestSetting, now time.Time) time.Time {
+	scheduled := time.Date(now.Year(), now.Month(), now.Day(), int(setting.SendHour), 0, 0, 0, time.UTC)
+	if setting.Frequency == digestWeekly {
+		scheduled = scheduled.AddDate(0, 0, int(setting.Weekday)-int(scheduled.Weekday()))
+		if scheduled.After(now) {
+			scheduled = scheduled.AddDate(0, 0, -7)
+		}
+		return scheduled
+	}
+	if scheduled.After(now) {
+		scheduled = scheduled.AddDate(0, 0, -1)
+	}
+	return scheduled
+}
+
+// digestDue reports whether a digest's scheduled time has passed since it
+// was last sent, or since it was set up if it's never been sent.
+func digestDue(setting database.DigestSetting, now time.Time) bool {
+	last := setting.CreatedAt
+	if setting.LastSentAt.Valid {
+		last = setting.LastSentAt.Time
+	}
+	return last.Before(digestScheduledAt(setting, now))
+}
+
+// sendDigest emails the user their unread posts since the last digest and
+// records it as sent. Nothing is emailed if there's nothing unread.
+func (cfg *apiConfig) sendDigest(ctx context.Context, setting database.DigestSetting, now time.Time) error {
+	if cfg.Mailer == nil {
+		return fmt.Errorf("email isn't configured")
+	}
+
+	since := setting.LastSentAt.Time
+	if !setting.LastSentAt.Valid {
+		since = now.AddDate(0, 0, -1)
+		if setting.Frequency == digestWeekly {
+			since = now.AddDate(0, 0, -7)
+		}
+	}
+	posts, err := cfg.DB.GetUnreadPostsForDigest(ctx, database.GetUnreadPostsForDigestParams{
+		UserID:  setting.UserID,
+		Since:   since,
+		FeedIds: setting.FeedIds,
+		Limit:   maxDigestPosts,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(posts) > 0 {
+		user, err := cfg.DB.GetUserByID(ctx, setting.UserID)
+		if err != nil {
+			return err
+		}
+		msg, err := cfg.renderDigest(ctx, user, setting, posts)
+		if err != nil {
+			return err
+		}
+		if err := cfg.Mailer.send(msg); err != nil {
+			return err
+		}
+	}
+
+	return cfg.DB.MarkDigestSent(ctx, database.MarkDigestSentParams{
+		UserID:     setting.UserID,
+		LastSentAt: sql.NullTime{Time: now, Valid: true},
+	})
+}
+
+func (cfg *apiConfig) renderDigest(ctx context.Context, user database.User, setting database.DigestSetting, posts []database.Post) (email, error) {
+	data := digestData{Name: user.Name, Count: len(posts)}
+	sections := map[uuid.UUID]int{}
+	for _, post := range posts {
+		i, ok := sections[post.FeedID]
+		if !ok {
+			feed, err := cfg.DB.GetFeedByID(ctx, post.FeedID)
+			if err != nil {
+				return email{}, err
+			}
+			i = len(data.Feeds)
+			sections[post.FeedID] = i
+			data.Feeds = append(data.Feeds, digestFeed{Name: feed.Name})
+		}
+		data.Feeds[i].Posts = append(data.Feeds[i].Posts, digestPost{
+			Title:   post.Title,
+			Url:     post.Url,
+			Summary: post.Summary.String,
+		})
+	}
+
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, data); err != nil {
+		return email{}, err
+	}
+	if err := digestHTMLTemplate.Execute(&html, data); err != nil {
+		return email{}, err
+	}
+	subject := fmt.Sprintf("Your %s digest: %d unread posts", setting.Frequency, len(posts))
+	return email{
+		To:      setting.Email,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// digestConfirmationEmail asks the owner of a digest address to confirm it
+// by following a link back to us.
+func (cfg *apiConfig) digestConfirmationEmail(user database.User, setting database.DigestSetting) (email, error) {
+	link := strings.TrimRight(cfg.PublicBaseURL, "/") + "/v1/digest/verify?" + url.Values{
+		"token": {setting.VerificationToken.String},
+	}.Encode()
+	data := struct {
+		Name string
+		Link string
+	}{user.Name, link}
+
+	var text, html bytes.Buffer
+	if err := digestConfirmationTextTemplate.Execute(&text, data); err != nil {
+		return email{}, err
+	}
+	if err := digestConfirmationHTMLTemplate.Execute(&html, data); err != nil {
+		return email{}, err
+	}
+	return email{
+		To:      setting.Email,
+		Subject: "Confirm your digest email address",
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// fakeMailer records the email it's asked to send instead of sending it,
+// or fails with err if it's set.
+type fakeMailer struct {
+	sent []email
+	err  error
+}
+
+func (m *fakeMailer) send(msg email) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestDigestDue(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	sent := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+
+	tests := []struct {
+		name    string
+		setting database.DigestSetting
+		want    bool
+	}{
+		{
+			name:    "daily, sent before today's hour",
+			setting: database.DigestSetting{Frequency: digestDaily, SendHour: 9, LastSentAt: sent(now.AddDate(0, 0, -1))},
+			want:    true,
+		},
+		{
+			name:    "daily, already sent today",
+			setting: database.DigestSetting{Frequency: digestDaily, SendHour: 9, LastSentAt: sent(now.Add(-time.Hour))},
+			want:    false,
+		},
+		{
+			name:    "daily, hour not reached yet",
+			setting: database.DigestSetting{Frequency: digestDaily, SendHour: 11, LastSentAt: sent(now.Add(-20 * time.Hour))},
+			want:    false,
+		},
+		{
+			name:    "weekly, sent last week",
+			setting: database.DigestSetting{Frequency: digestWeekly, SendHour: 9, Weekday: 1, LastSentAt: sent(now.AddDate(0, 0, -9))},
+			want:    true,
+		},
+		{
+			name:    "weekly, sent this week",
+			setting: database.DigestSetting{Frequency: digestWeekly, SendHour: 9, Weekday: 1, LastSentAt: sent(now.AddDate(0, 0, -2))},
+			want:    false,
+		},
+		{
+			name:    "never sent, set up after the last scheduled time",
+			setting: database.DigestSetting{Frequency: digestDaily, SendHour: 9, CreatedAt: now.Add(-time.Minute)},
+			want:    false,
+		},
+		{
+			name:    "never sent, scheduled time passed since setup",
+			setting: database.DigestSetting{Frequency: digestDaily, SendHour: 9, CreatedAt: now.AddDate(0, 0, -1)},
+			want:    true,
+		},
+		{
+			name:    "never sent, weekly, set up mid-week",
+			setting: database.DigestSetting{Frequency: digestWeekly, SendHour: 9, Weekday: 1, CreatedAt: now.AddDate(0, 0, -1)},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digestDue(tt.setting, now); got != tt.want {
+				t.Errorf("digestDue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	mailer := &fakeMailer{}
+	cfg.Mailer = mailer
+
+	now := time.Now().UTC()
+	user := database.User{ID: uuid.New(), Name: "Ada"}
+	feed := database.Feed{ID: uuid.New(), Name: "Systems <Weekly>"}
+	setting := database.DigestSetting{
+		UserID:     user.ID,
+		Email:      "ada@example.com",
+		Frequency:  digestDaily,
+		LastSentAt: sql.NullTime{Time: now.AddDate(0, 0, -1), Valid: true},
+	}
+	posts := []interface{}{
+		database.Post{
+			ID:      uuid.New(),
+			FeedID:  feed.ID,
+			Title:   "Tags & <b>things</b>",
+			Url:     "https://blog.example/tags?a=1&b=2",
+			Summary: sql.NullString{String: "A summary.", Valid: true},
+		},
+		database.Post{
+			ID:     uuid.New(),
+			FeedID: feed.ID,
+			Title:  "Second post",
+			Url:    "https://blog.example/second",
+		},
+	}
+
+	mock.ExpectQuery(query("GetUnreadPostsForDigest")).
+		WithArgs(user.ID, setting.LastSentAt.Time, sqlmock.AnyArg(), maxDigestPosts).
+		WillReturnRows(modelRows(posts...))
+	mock.ExpectQuery(query("GetUserByID")).
+		WithArgs(user.ID).
+		WillReturnRows(modelRows(user))
+	mock.ExpectQuery(query("GetFeedByID")).
+		WithArgs(feed.ID).
+		WillReturnRows(modelRows(feed))
+	mock.ExpectExec(query("MarkDigestSent")).
+		WithArgs(user.ID, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := cfg.sendDigest(context.Background(), setting, now); err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mailer.sent))
+	}
+	msg := mailer.sent[0]
+	if msg.To != setting.Email {
+		t.Errorf("To = %q, want %q", msg.To, setting.Email)
+	}
+	if want := "Your daily digest: 2 unread posts"; msg.Subject != want {
+		t.Errorf("Subject = %q, want %q", msg.Subject, want)
+	}
+
+	for _, want := range []string{
+		"Hi Ada, here are 2 unread posts.",
+		"== Systems <Weekly> ==",
+		"* Tags & <b>things</b>\n  https://blog.example/tags?a=1&b=2\n  A summary.",
+		"* Second post\n  https://blog.example/second\n",
+	} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("text is missing %q:\n%s", want, msg.Text)
+		}
+	}
+	for _, want := range []string{
+		"<p>Hi Ada, here are 2 unread posts.</p>",
+		"<h2>Systems &lt;Weekly&gt;</h2>",
+		`<a href="https://blog.example/tags?a=1&amp;b=2">Tags &amp; &lt;b&gt;things&lt;/b&gt;</a>`,
+		"<p>A summary.</p>",
+		`<a href="https://blog.example/second">Second post</a>`,
+	} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("HTML is missing %q:\n%s", want, msg.HTML)
+		}
+	}
+}
+
+func TestSendDigestNothingUnread(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	mailer := &fakeMailer{}
+	cfg.Mailer = mailer
+
+	now := time.Now().UTC()
+	setting := database.DigestSetting{
+		UserID:    uuid.New(),
+		Email:     "ada@example.com",
+		Frequency: digestWeekly,
+	}
+	mock.ExpectQuery(query("GetUnreadPostsForDigest")).
+		WithArgs(setting.UserID, now.AddDate(0, 0, -7), sqlmock.AnyArg(), maxDigestPosts).
+		WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectExec(query("MarkDigestSent")).
+		WithArgs(setting.UserID, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := cfg.sendDigest(context.Background(), setting, now); err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("sent %d emails, want none", len(mailer.sent))
+	}
+}
+
+func TestSMTPRender(t *testing.T) {
+	server := &smtpConfig{Host: "mail.example", From: "Reader <reader@example.com>"}
+	msg := email{
+		To:      "ada@example.com",
+		Subject: "Your daily digest: 1 unread post — café",
+		Text:    "Hi Ada,\n* A very long line that quoted-printable has to wrap because it runs well past seventy-six characters\n",
+		HTML:    `<p>Hi Ada, <a href="https://blog.example/?a=1&amp;b=2">café</a></p>`,
+	}
+	body, err := server.render(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Header.Get("To"); got != msg.To {
+		t.Errorf("To = %q, want %q", got, msg.To)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != msg.Subject {
+		t.Errorf("Subject = %q, want %q", subject, msg.Subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", mediaType)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type = %q, want %q", got, want.contentType)
+		}
+		// The reader undoes the quoted-printable encoding, which sends
+		// line breaks as CRLF.
+		got, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantBody := strings.ReplaceAll(want.body, "\n", "\r\n"); string(got) != wantBody {
+			t.Errorf("%s part = %q, want %q", want.contentType, got, wantBody)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("extra part after the HTML one: %v", err)
+	}
+}
+
+func TestUpdateDigestSettingsRejectsUnfollowedFeeds(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	cfg.Mailer = &fakeMailer{}
+	cfg.PublicBaseURL = "https://reader.example"
+	user := database.User{ID: uuid.New()}
+	followed := database.FeedFollow{ID: uuid.New(), UserID: user.ID, FeedID: uuid.New()}
+	mock.ExpectQuery(query("GetFeedFollows")).
+		WithArgs(user.ID).
+		WillReturnRows(modelRows(followed))
+
+	body := `{"email":"ada@example.com","feed_ids":["` + followed.FeedID.String() + `","` + uuid.NewString() + `"]}`
+	w := httptest.NewRecorder()
+	cfg.updateDigestSettingsHandler(w, httptest.NewRequest(http.MethodPut, "/v1/digest", strings.NewReader(body)), user)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestUpdateDigestSettingsConfirmation(t *testing.T) {
+	user := database.User{ID: uuid.New(), Name: "Ada"}
+	body := `{"email":"Ada <ada@example.com>","frequency":"weekly","send_hour":8,"weekday":1}`
+	update := func(cfg *apiConfig) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cfg.updateDigestSettingsHandler(w, httptest.NewRequest(http.MethodPut, "/v1/digest", strings.NewReader(body)), user)
+		return w
+	}
+	expectUpsert := func(mock sqlmock.Sqlmock, saved database.DigestSetting) {
+		mock.ExpectQuery(query("UpsertDigestSettings")).
+			WithArgs(user.ID, timeNear{time.Now()}, timeNear{time.Now()}, "ada@example.com", digestWeekly, int32(8), int32(1), sqlmock.AnyArg(), true, sqlmock.AnyArg()).
+			WillReturnRows(modelRows(saved))
+	}
+
+	t.Run("new address", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mailer := &fakeMailer{}
+		cfg.Mailer = mailer
+		cfg.PublicBaseURL = "https://reader.example/"
+		expectUpsert(mock, database.DigestSetting{
+			UserID:            user.ID,
+			Email:             "ada@example.com",
+			Frequency:         digestWeekly,
+			Enabled:           true,
+			VerificationToken: sql.NullString{String: "t0ken", Valid: true},
+		})
+
+		w := update(cfg)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), `"email_verified":false`) {
+			t.Errorf("body = %s, want the address unverified", w.Body)
+		}
+		if len(mailer.sent) != 1 {
+			t.Fatalf("sent %d emails, want 1", len(mailer.sent))
+		}
+		msg := mailer.sent[0]
+		if msg.To != "ada@example.com" {
+			t.Errorf("To = %q, want the new address", msg.To)
+		}
+		link := "https://reader.example/v1/digest/verify?token=t0ken"
+		if !strings.Contains(msg.Text, link) || !strings.Contains(msg.HTML, `href="`+link+`"`) {
+			t.Errorf("confirmation is missing %s:\n%s\n%s", link, msg.Text, msg.HTML)
+		}
+	})
+
+	t.Run("already confirmed", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mailer := &fakeMailer{}
+		cfg.Mailer = mailer
+		cfg.PublicBaseURL = "https://reader.example"
+		expectUpsert(mock, database.DigestSetting{
+			UserID:          user.ID,
+			Email:           "ada@example.com",
+			Frequency:       digestWeekly,
+			Enabled:         true,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+
+		if w := update(cfg); w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		if len(mailer.sent) != 0 {
+			t.Errorf("sent %d emails, want none", len(mailer.sent))
+		}
+	})
+
+	t.Run("mail server fails", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.Mailer = &fakeMailer{err: errors.New("dial tcp 10.0.0.5:25: connection refused")}
+		cfg.PublicBaseURL = "https://reader.example"
+		expectUpsert(mock, database.DigestSetting{
+			UserID:            user.ID,
+			Email:             "ada@example.com",
+			VerificationToken: sql.NullString{String: "t0ken", Valid: true},
+		})
+
+		w := update(cfg)
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+		}
+		if strings.Contains(w.Body.String(), "10.0.0.5") {
+			t.Errorf("body leaks the mail server error: %s", w.Body)
+		}
+	})
+
+	t.Run("email not configured", func(t *testing.T) {
+		cfg, _ := newMockConfig(t)
+		if w := update(cfg); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+	})
+}
+
+func TestVerifyDigestEmailHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		verified int64
+		want     int
+	}{
+		{"valid", "t0ken", 1, http.StatusOK},
+		{"unknown or used", "t0ken", 0, http.StatusNotFound},
+		{"missing", "", 0, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			if tt.token != "" {
+				mock.ExpectExec(query("VerifyDigestEmail")).
+					WithArgs(tt.token).
+					WillReturnResult(sqlmock.NewResult(0, tt.verified))
+			}
+
+			w := httptest.NewRecorder()
+			cfg.verifyDigestEmailHandler(w, httptest.NewRequest(http.MethodGet, "/v1/digest/verify?token="+tt.token, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendDigestHandler(t *testing.T) {
+	user := database.User{ID: uuid.New(), Name: "Ada"}
+	verified := sql.NullTime{Time: time.Now().AddDate(0, 0, -30), Valid: true}
+	send := func(cfg *apiConfig) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cfg.sendDigestHandler(w, httptest.NewRequest(http.MethodPost, "/v1/digest/send", nil), user)
+		return w
+	}
+
+	t.Run("unconfirmed address", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.Mailer = &fakeMailer{}
+		mock.ExpectQuery(query("GetDigestSettings")).
+			WithArgs(user.ID).
+			WillReturnRows(modelRows(database.DigestSetting{UserID: user.ID, Email: "ada@example.com"}))
+
+		if w := send(cfg); w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("sent recently", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.Mailer = &fakeMailer{}
+		mock.ExpectQuery(query("GetDigestSettings")).
+			WithArgs(user.ID).
+			WillReturnRows(modelRows(database.DigestSetting{
+				UserID:          user.ID,
+				Email:           "ada@example.com",
+				EmailVerifiedAt: verified,
+				LastSentAt:      sql.NullTime{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+			}))
+
+		if w := send(cfg); w.Code != http.StatusTooManyRequests {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("mail server fails", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.Mailer = &fakeMailer{err: errors.New("535 5.7.8 authentication failed for relay.internal")}
+		feed := database.Feed{ID: uuid.New(), Name: "Blog"}
+		mock.ExpectQuery(query("GetDigestSettings")).
+			WithArgs(user.ID).
+			WillReturnRows(modelRows(database.DigestSetting{
+				UserID:          user.ID,
+				Email:           "ada@example.com",
+				Frequency:       digestDaily,
+				EmailVerifiedAt: verified,
+				LastSentAt:      sql.NullTime{Time: time.Now().UTC().Add(-time.Hour), Valid: true},
+			}))
+		mock.ExpectQuery(query("GetUnreadPostsForDigest")).
+			WillReturnRows(modelRows(database.Post{ID: uuid.New(), FeedID: feed.ID, Title: "Post"}))
+		mock.ExpectQuery(query("GetUserByID")).
+			WithArgs(user.ID).
+			WillReturnRows(modelRows(user))
+		mock.ExpectQuery(query("GetFeedByID")).
+			WithArgs(feed.ID).
+			WillReturnRows(modelRows(feed))
+
+		w := send(cfg)
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+		}
+		if strings.Contains(w.Body.String(), "relay.internal") {
+			t.Errorf("body leaks the mail server error: %s", w.Body)
+		}
+	})
+}
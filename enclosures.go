@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// createEnclosures stores the enclosures of item against post. The podcast
+// metadata in the iTunes namespace describes the whole episode, so it's
+// copied onto every enclosure.
+func (cfg *apiConfig) createEnclosures(ctx context.Context, post database.Post, item RSSItem) {
+	for _, enclosure := range item.Enclosures {
+		if enclosure.URL == "" {
+			continue
+		}
+
+		_, err := cfg.DB.CreatePostEnclosure(ctx, database.CreatePostEnclosureParams{
+			ID:              uuid.New(),
+			CreatedAt:       time.Now().UTC(),
+			UpdatedAt:       time.Now().UTC(),
+			PostID:          post.ID,
+			Url:             enclosure.URL,
+			Length:          parseNullInt64(enclosure.Length),
+			MimeType:        toNullString(enclosure.Type),
+			DurationSeconds: parseITunesDuration(item.ITunesDuration),
+			ImageUrl:        toNullString(item.ITunesImage.Href),
+			Season:          parseNullInt32(item.ITunesSeason),
+			Episode:         parseNullInt32(item.ITunesEpisode),
+		})
+		if err != nil {
+			log.Printf("Couldn't create enclosure for post %s: %v", post.ID, err)
+		}
+	}
+}
+
+// parseITunesDuration parses an itunes:duration value, which is either a
+// number of seconds or [[HH:]MM:]SS.
+func parseITunesDuration(s string) sql.NullInt32 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return sql.NullInt32{}
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return sql.NullInt32{}
+	}
+	seconds := 0
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return sql.NullInt32{}
+		}
+		seconds = seconds*60 + n
+	}
+	return sql.NullInt32{
+		Int32: int32(seconds),
+		Valid: true,
+	}
+}
+
+func toNullString(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{
+		String: s,
+		Valid:  s != "",
+	}
+}
+
+func parseNullInt32(s string) sql.NullInt32 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{
+		Int32: int32(n),
+		Valid: true,
+	}
+}
+
+func parseNullInt64(s string) sql.NullInt64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{
+		Int64: n,
+		Valid: true,
+	}
+}
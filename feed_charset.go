@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// newFeedDecoder returns an XML decoder that transcodes r to UTF-8. The
+// charset from the Content-Type header takes precedence over the encoding in
+// the XML declaration, as RFC 7303 specifies; without one, the declaration is
+// used.
+func newFeedDecoder(r io.Reader, contentType string) (*xml.Decoder, error) {
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = strings.TrimSpace(params["charset"])
+	}
+
+	if label == "" {
+		decoder := xml.NewDecoder(r)
+		decoder.CharsetReader = charset.NewReaderLabel
+		return decoder, nil
+	}
+
+	utf8Reader, err := charset.NewReaderLabel(label, r)
+	if err != nil {
+		return nil, err
+	}
+	decoder := xml.NewDecoder(utf8Reader)
+	// The body is already UTF-8, so ignore whatever the declaration says.
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFeedDecoder(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		contentType string
+		want        string
+	}{
+		{
+			name:        "utf-8",
+			file:        "utf-8.xml",
+			contentType: "application/rss+xml",
+			want:        "Café – naïve",
+		},
+		{
+			name:        "iso-8859-1 from xml declaration",
+			file:        "iso-8859-1.xml",
+			contentType: "application/rss+xml",
+			want:        "Café Olé",
+		},
+		{
+			name:        "windows-1252 from xml declaration",
+			file:        "windows-1252.xml",
+			contentType: "text/xml",
+			want:        "“Quoted” €5",
+		},
+		{
+			name:        "charset only in content type",
+			file:        "content-type-only.xml",
+			contentType: "application/rss+xml; charset=ISO-8859-1",
+			want:        "Müller & Söhne",
+		},
+		{
+			name:        "content type overrides xml declaration",
+			file:        "mismatch.xml",
+			contentType: "application/rss+xml; charset=windows-1252",
+			want:        "“Smart” quotes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "charset", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			decoder, err := newFeedDecoder(f, tt.contentType)
+			if err != nil {
+				t.Fatalf("newFeedDecoder: %v", err)
+			}
+			feed := RSSFeed{}
+			if err := decoder.Decode(&feed); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if feed.Channel.Title != tt.want {
+				t.Errorf("title = %q, want %q", feed.Channel.Title, tt.want)
+			}
+		})
+	}
+}
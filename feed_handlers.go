@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/m-rstewart/go-rss/internal/database"
 )
@@ -16,12 +22,41 @@ type FeedResponse struct {
 }
 
 type Feed struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"`
-	Url       string    `json:"url"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID                 uuid.UUID  `json:"id"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	Name               string     `json:"name"`
+	Url                string     `json:"url"`
+	UserID             uuid.UUID  `json:"user_id"`
+	SiteUrl            *string    `json:"site_url"`
+	Description        *string    `json:"description"`
+	Language           *string    `json:"language"`
+	ImageUrl           *string    `json:"image_url"`
+	Generator          *string    `json:"generator"`
+	LastFetchedAt      *time.Time `json:"last_fetched_at"`
+	LastError          *string    `json:"last_error"`
+	DeadAt             *time.Time `json:"dead_at"`
+	ExtractFullContent bool       `json:"extract_full_content"`
+}
+
+func databaseFeedToFeed(feed database.Feed) Feed {
+	return Feed{
+		ID:                 feed.ID,
+		CreatedAt:          feed.CreatedAt,
+		UpdatedAt:          feed.UpdatedAt,
+		Name:               feed.Name,
+		Url:                feed.Url,
+		UserID:             feed.UserID,
+		SiteUrl:            nullStringPtr(feed.SiteUrl),
+		Description:        nullStringPtr(feed.Description),
+		Language:           nullStringPtr(feed.Language),
+		ImageUrl:           nullStringPtr(feed.ImageUrl),
+		Generator:          nullStringPtr(feed.Generator),
+		LastFetchedAt:      nullTimePtr(feed.LastFetchedAt),
+		LastError:          nullStringPtr(feed.LastError),
+		DeadAt:             nullTimePtr(feed.DeadAt),
+		ExtractFullContent: feed.ExtractFullContent,
+	}
 }
 
 func (cfg *apiConfig) createFeedHandler(w http.ResponseWriter, r *http.Request, user database.User) {
@@ -39,18 +74,18 @@ func (cfg *apiConfig) createFeedHandler(w http.ResponseWriter, r *http.Request,
 	}
 	defer r.Body.Close()
 
-	feedParams := database.CreateFeedParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		Name:      params.Name,
-		Url:       params.Url,
-		UserID:    user.ID,
+	feed, err := cfg.createFeed(r.Context(), user, params.Name, params.Url)
+	if errors.Is(err, errInvalidFeedURL) || errors.Is(err, errFeedUnavailable) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-
-	feed, err := cfg.DB.CreateFeed(r.Context(), feedParams)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			respondWithError(w, http.StatusConflict, "Feed already exists")
+			return
+		}
+		log.Printf("Couldn't create feed %s: %v", params.Url, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create feed")
 		return
 	}
 
@@ -64,17 +99,10 @@ func (cfg *apiConfig) createFeedHandler(w http.ResponseWriter, r *http.Request,
 
 	feedFollow, err := cfg.DB.CreateFeedFollow(r.Context(), feedFollowParams)
 	if err != nil {
-		fmt.Errorf("Error creating feed follow")
+		log.Printf("Error creating feed follow: %v", err)
 	}
 
-	createdFeed := Feed{
-		ID:        feed.ID,
-		CreatedAt: feed.CreatedAt,
-		UpdatedAt: feed.UpdatedAt,
-		Name:      feed.Name,
-		Url:       feed.Url,
-		UserID:    feed.UserID,
-	}
+	createdFeed := databaseFeedToFeed(feed)
 	createdFeedFollow := FeedFollowResponse{
 		ID:        feed.ID,
 		FeedID:    feedFollow.FeedID,
@@ -91,9 +119,50 @@ func (cfg *apiConfig) createFeedHandler(w http.ResponseWriter, r *http.Request,
 	respondWithJSON(w, http.StatusCreated, res)
 }
 
+var (
+	errInvalidFeedURL  = errors.New("invalid feed URL")
+	errFeedUnavailable = errors.New("couldn't fetch feed")
+)
+
+// canonicalFeedURL is the form feed URLs are stored and looked up in.
+func canonicalFeedURL(rawURL string) string {
+	return canonicalizeURL(rawURL, "")
+}
+
+// createFeed adds the feed at rawURL after checking that it's a URL we're
+// allowed to fetch and that it serves a feed. An empty name is filled in
+// from the feed's title. Errors a client can fix wrap errInvalidFeedURL or
+// errFeedUnavailable; why a fetch failed is only logged, since it can say
+// things about our network.
+func (cfg *apiConfig) createFeed(ctx context.Context, user database.User, name, rawURL string) (database.Feed, error) {
+	if err := validateFeedURL(rawURL); err != nil {
+		return database.Feed{}, fmt.Errorf("%w: %v", errInvalidFeedURL, err)
+	}
+	feedURL := canonicalFeedURL(rawURL)
+	feedData, _, err := cfg.fetchFeed(feedURL)
+	if err != nil {
+		log.Printf("Couldn't fetch new feed %s: %v", feedURL, err)
+		return database.Feed{}, errFeedUnavailable
+	}
+	if name == "" {
+		name = strings.TrimSpace(feedData.Channel.Title)
+	}
+	if name == "" {
+		name = feedURL
+	}
+	return cfg.DB.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      name,
+		Url:       feedURL,
+		UserID:    user.ID,
+	})
+}
+
 func (cfg *apiConfig) getAllFeeds(w http.ResponseWriter, r *http.Request) {
 	type FeedsResponse struct {
-		Feeds []database.Feed `json:"feeds"`
+		Feeds []Feed `json:"feeds"`
 	}
 
 	feeds, err := cfg.DB.GetFeeds(r.Context())
@@ -103,8 +172,49 @@ func (cfg *apiConfig) getAllFeeds(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := FeedsResponse{
-		Feeds: feeds,
+		Feeds: make([]Feed, 0, len(feeds)),
+	}
+	for _, feed := range feeds {
+		res.Feeds = append(res.Feeds, databaseFeedToFeed(feed))
 	}
 
 	respondWithJSON(w, http.StatusOK, res)
 }
+
+func (cfg *apiConfig) updateFeedHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		ExtractFullContent bool `json:"extract_full_content"`
+	}
+
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid feed ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	// Only the user who added a feed may change how it's scraped.
+	feed, err := cfg.DB.SetFeedExtractFullContent(r.Context(), database.SetFeedExtractFullContentParams{
+		ID:                 feedID,
+		ExtractFullContent: params.ExtractFullContent,
+		UserID:             user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update feed")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseFeedToFeed(feed))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// A feed has to permanently redirect to the same place on this many
+// consecutive fetches before we trust the move and rewrite its URL.
+const permanentRedirectThreshold = 3
+
+// handleFeedRedirect records permanent redirects seen while fetching feed and,
+// once they've been repeated enough, moves the feed to its new URL. It
+// returns the feed that posts should be stored against, which differs from
+// feed when it was merged into an existing feed with the target URL.
+func (cfg *apiConfig) handleFeedRedirect(ctx context.Context, feed database.Feed, result fetchResult) (database.Feed, error) {
+	// Feed URLs are stored canonicalized, so the target has to be too for the
+	// comparisons and the lookup below to find the same feed.
+	permanentURL := canonicalFeedURL(result.PermanentURL)
+	if permanentURL == "" || permanentURL == feed.Url {
+		if feed.RedirectCount == 0 {
+			return feed, nil
+		}
+		return feed, cfg.DB.SetFeedRedirect(ctx, database.SetFeedRedirectParams{
+			ID: feed.ID,
+		})
+	}
+
+	count := int32(1)
+	if feed.RedirectUrl.Valid && feed.RedirectUrl.String == permanentURL {
+		count = feed.RedirectCount + 1
+	}
+	if count < permanentRedirectThreshold {
+		return feed, cfg.DB.SetFeedRedirect(ctx, database.SetFeedRedirectParams{
+			ID: feed.ID,
+			RedirectUrl: sql.NullString{
+				String: permanentURL,
+				Valid:  true,
+			},
+			RedirectCount: count,
+		})
+	}
+
+	existing, err := cfg.DB.GetFeedByURL(ctx, permanentURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Feed %s moved permanently to %s", feed.Name, permanentURL)
+		err = cfg.DB.UpdateFeedURL(ctx, database.UpdateFeedURLParams{
+			ID:  feed.ID,
+			Url: permanentURL,
+		})
+		if err != nil {
+			return feed, err
+		}
+		feed.Url = permanentURL
+		return feed, nil
+	}
+	if err != nil {
+		return feed, err
+	}
+
+	log.Printf("Feed %s moved permanently to %s, merging into feed %s", feed.Name, permanentURL, existing.Name)
+	if err := cfg.mergeFeeds(ctx, feed, existing); err != nil {
+		return feed, err
+	}
+	return existing, nil
+}
+
+// mergeFeeds moves the follows and posts of from onto into and deletes from.
+// Users already following into keep their existing follow.
+func (cfg *apiConfig) mergeFeeds(ctx context.Context, from, into database.Feed) error {
+	tx, err := cfg.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	err = qtx.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{
+		NewFeedID: into.ID,
+		OldFeedID: from.ID,
+	})
+	if err != nil {
+		return err
+	}
+	err = qtx.MovePosts(ctx, database.MovePostsParams{
+		NewFeedID: into.ID,
+		OldFeedID: from.ID,
+	})
+	if err != nil {
+		return err
+	}
+	err = qtx.DeleteFeed(ctx, from.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
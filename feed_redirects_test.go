@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+func TestHandleFeedRedirectCanonicalizesTarget(t *testing.T) {
+	const target = "https://new.example/feed/?id=2&a=1"
+
+	t.Run("counts the same target", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		feed := database.Feed{
+			ID:            uuid.New(),
+			Url:           "https://old.example/feed",
+			RedirectUrl:   sql.NullString{String: target, Valid: true},
+			RedirectCount: 1,
+		}
+		mock.ExpectExec(query("SetFeedRedirect")).
+			WithArgs(feed.ID, target, int32(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		result := fetchResult{PermanentURL: "HTTPS://New.Example:443/feed/?id=2&utm_source=rss&a=1#top"}
+		if _, err := cfg.handleFeedRedirect(context.Background(), feed, result); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("moves to the canonical URL", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		feed := database.Feed{
+			ID:            uuid.New(),
+			Url:           "https://old.example/feed",
+			RedirectUrl:   sql.NullString{String: target, Valid: true},
+			RedirectCount: permanentRedirectThreshold - 1,
+		}
+		mock.ExpectQuery(query("GetFeedByURL")).
+			WithArgs(target).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectExec(query("UpdateFeedURL")).
+			WithArgs(feed.ID, target).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		result := fetchResult{PermanentURL: "https://NEW.example/feed/?id=2&a=1&fbclid=x"}
+		got, err := cfg.handleFeedRedirect(context.Background(), feed, result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Url != target {
+			t.Errorf("feed URL = %q, want %q", got.Url, target)
+		}
+	})
+
+	t.Run("same feed after canonicalizing", func(t *testing.T) {
+		cfg, _ := newMockConfig(t)
+		feed := database.Feed{ID: uuid.New(), Url: "https://old.example/feed"}
+		result := fetchResult{PermanentURL: "https://Old.Example/feed#x"}
+		if _, err := cfg.handleFeedRedirect(context.Background(), feed, result); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
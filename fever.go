@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+const (
+	feverAPIVersion = 3
+	// feverItemsLimit is how many items Fever clients get per request, as
+	// the spec requires.
+	feverItemsLimit = 50
+	// feverGroupID is the one group we report. Every followed feed is in
+	// it.
+	feverGroupID = 1
+)
+
+type feverGroup struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type feverFeedsGroup struct {
+	GroupID int64  `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type feverFeed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	Url               string `json:"url"`
+	SiteUrl           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type feverItem struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	Url           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// feverHandler implements the Fever API (https://feedafever.com/api) so
+// reader apps that speak it can use this server. Clients authenticate with
+// md5("<username>:<password>") using the password set through
+// PUT /v1/users/client_password. All of the user's feeds are reported in a
+// single group.
+func (cfg *apiConfig) feverHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse form")
+		return
+	}
+	res := map[string]interface{}{
+		"api_version": feverAPIVersion,
+		"auth":        0,
+	}
+
+	apiKey := strings.ToLower(r.PostForm.Get("api_key"))
+	if apiKey == "" {
+		respondWithJSON(w, http.StatusOK, res)
+		return
+	}
+	user, err := cfg.DB.GetUserByFeverAPIKey(r.Context(), sql.NullString{String: apiKey, Valid: true})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	res["auth"] = 1
+
+	feeds, err := cfg.DB.GetFollowedFeeds(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feeds")
+		return
+	}
+	feedSeqs := make(map[uuid.UUID]int64, len(feeds))
+	lastRefreshed := int64(0)
+	for _, feed := range feeds {
+		feedSeqs[feed.ID] = feed.Seq
+		if feed.LastFetchedAt.Valid {
+			lastRefreshed = max(lastRefreshed, feed.LastFetchedAt.Time.Unix())
+		}
+	}
+	res["last_refreshed_on_time"] = lastRefreshed
+
+	if r.Form.Has("mark") {
+		if err := cfg.feverMark(r.Context(), user, r.Form); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	query := r.URL.Query()
+	if query.Has("groups") || query.Has("feeds") {
+		feedIDs := make([]string, 0, len(feeds))
+		for _, feed := range feeds {
+			feedIDs = append(feedIDs, strconv.FormatInt(feed.Seq, 10))
+		}
+		res["feeds_groups"] = []feverFeedsGroup{{
+			GroupID: feverGroupID,
+			FeedIDs: strings.Join(feedIDs, ","),
+		}}
+	}
+	if query.Has("groups") {
+		res["groups"] = []feverGroup{{ID: feverGroupID, Title: "All"}}
+	}
+	if query.Has("feeds") {
+		res["feeds"] = feverFeeds(feeds)
+	}
+	if query.Has("favicons") {
+		res["favicons"] = []struct{}{}
+	}
+	if query.Has("links") {
+		res["links"] = []struct{}{}
+	}
+	if query.Has("items") {
+		items, total, err := cfg.feverItems(r.Context(), user, query, feedSeqs)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get items")
+			return
+		}
+		res["items"] = items
+		res["total_items"] = total
+	}
+	if query.Has("unread_item_ids") || r.Form.Get("as") == "read" || r.Form.Get("as") == "unread" {
+		seqs, err := cfg.DB.GetUnreadPostSeqs(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get unread items")
+			return
+		}
+		res["unread_item_ids"] = joinSeqs(seqs)
+	}
+	if query.Has("saved_item_ids") || r.Form.Get("as") == "saved" || r.Form.Get("as") == "unsaved" {
+		seqs, err := cfg.DB.GetStarredPostSeqs(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get saved items")
+			return
+		}
+		res["saved_item_ids"] = joinSeqs(seqs)
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func feverFeeds(feeds []database.Feed) []feverFeed {
+	res := make([]feverFeed, 0, len(feeds))
+	for _, feed := range feeds {
+		updated := int64(0)
+		if feed.LastFetchedAt.Valid {
+			updated = feed.LastFetchedAt.Time.Unix()
+		}
+		res = append(res, feverFeed{
+			ID:                feed.Seq,
+			Title:             feed.Name,
+			Url:               feed.Url,
+			SiteUrl:           feed.SiteUrl.String,
+			LastUpdatedOnTime: updated,
+		})
+	}
+	return res
+}
+
+// feverItems returns up to feverItemsLimit items: those listed in with_ids,
+// those after since_id oldest first, or those before max_id newest first.
+func (cfg *apiConfig) feverItems(ctx context.Context, user database.User, query map[string][]string, feedSeqs map[uuid.UUID]int64) ([]feverItem, int64, error) {
+	params := database.GetClientItemsParams{
+		UserID:      user.ID,
+		MinSeq:      0,
+		MaxSeq:      math.MaxInt64,
+		Seqs:        []int64{},
+		NewestFirst: true,
+		Limit:       feverItemsLimit,
+	}
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if withIDs := get("with_ids"); withIDs != "" {
+		params.Seqs = parseSeqs(withIDs)
+		if len(params.Seqs) > feverItemsLimit {
+			params.Seqs = params.Seqs[:feverItemsLimit]
+		}
+	} else if sinceID, err := strconv.ParseInt(get("since_id"), 10, 64); err == nil {
+		params.MinSeq = sinceID
+		params.NewestFirst = false
+	} else if maxID, err := strconv.ParseInt(get("max_id"), 10, 64); err == nil && maxID > 0 {
+		params.MaxSeq = maxID
+	}
+
+	rows, err := cfg.DB.GetClientItems(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := cfg.DB.CountClientItems(ctx, user.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]feverItem, 0, len(rows))
+	for _, row := range rows {
+		post := databasePostToPost(clientItemPost(row), nil, postFormatHTML)
+		created := row.CreatedAt
+		if row.PublishedAt.Valid {
+			created = row.PublishedAt.Time
+		}
+		items = append(items, feverItem{
+			ID:            row.Seq,
+			FeedID:        feedSeqs[row.FeedID],
+			Title:         row.Title,
+			Author:        strings.Join(row.Authors, ", "),
+			HTML:          deref(post.Body),
+			Url:           row.Url,
+			IsSaved:       boolToInt(row.IsStarred),
+			IsRead:        boolToInt(row.IsRead),
+			CreatedOnTime: created.Unix(),
+		})
+	}
+	return items, total, nil
+}
+
+// feverMark applies a Fever mark request: an item read, unread, saved or
+// unsaved, or everything in a feed or group read up to a time.
+func (cfg *apiConfig) feverMark(ctx context.Context, user database.User, form map[string][]string) error {
+	get := func(key string) string {
+		if values := form[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	id, err := strconv.ParseInt(get("id"), 10, 64)
+	if err != nil {
+		return errors.New("invalid id")
+	}
+	as := get("as")
+	yes, no := true, false
+
+	switch get("mark") {
+	case "item":
+		post, err := cfg.DB.GetPostBySeq(ctx, id)
+		if err != nil {
+			return errors.New("item not found")
+		}
+		change := postStateChange{}
+		switch as {
+		case "read":
+			change.Read = &yes
+		case "unread":
+			change.Read = &no
+		case "saved":
+			change.Starred = &yes
+		case "unsaved":
+			change.Starred = &no
+		default:
+			return errors.New("invalid as")
+		}
+		_, err = cfg.setPostState(ctx, user.ID, post.ID, change)
+		return err
+	case "feed", "group":
+		if as != "read" {
+			return errors.New("invalid as")
+		}
+		before := time.Now().UTC()
+		if seconds, err := strconv.ParseInt(get("before"), 10, 64); err == nil {
+			before = time.Unix(seconds, 0).UTC()
+		}
+		feedID := uuid.NullUUID{}
+		if get("mark") == "feed" {
+			feed, err := cfg.DB.GetFeedBySeq(ctx, id)
+			if err != nil {
+				return errors.New("feed not found")
+			}
+			feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+		}
+		// Items report their publish time as created_on_time, so that's
+		// what before is compared against.
+		return cfg.markPostsRead(ctx, user, feedID, before, true)
+	}
+	return errors.New("invalid mark")
+}
+
+// markPostsRead marks the user's unread posts up to before read, in one
+// feed or, if feedID is null, all of them. Posts are compared by when we
+// ingested them, or by when they were published if byPublished is set.
+func (cfg *apiConfig) markPostsRead(ctx context.Context, user database.User, feedID uuid.NullUUID, before time.Time, byPublished bool) error {
+	states, err := cfg.DB.MarkPostsReadBefore(ctx, database.MarkPostsReadBeforeParams{
+		UpdatedAt:   time.Now().UTC(),
+		UserID:      user.ID,
+		FeedID:      feedID,
+		ByPublished: byPublished,
+		Before:      before,
+	})
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		cfg.Events.publishState(state)
+	}
+	return nil
+}
+
+func parseSeqs(s string) []int64 {
+	var seqs []int64
+	for _, part := range strings.Split(s, ",") {
+		if seq, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	return seqs
+}
+
+func joinSeqs(seqs []int64) string {
+	parts := make([]string, 0, len(seqs))
+	for _, seq := range seqs {
+		parts = append(parts, strconv.FormatInt(seq, 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
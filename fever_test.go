@@ -0,0 +1,236 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// feverRequest is a Fever API call: query selects what to return and form
+// carries the api_key and any mark.
+func feverRequest(query string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/fever/?api&"+query, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func feverUser() database.User {
+	return database.User{
+		ID:          uuid.New(),
+		Name:        "ada",
+		FeverApiKey: sql.NullString{String: feverAPIKey("ada", "correct horse"), Valid: true},
+	}
+}
+
+// expectFeverAuth expects the lookups every authenticated Fever call makes.
+func expectFeverAuth(mock sqlmock.Sqlmock, user database.User, feeds ...interface{}) {
+	mock.ExpectQuery(query("GetUserByFeverAPIKey")).
+		WithArgs(user.FeverApiKey.String).
+		WillReturnRows(modelRows(user))
+	rows := sqlmock.NewRows(nil)
+	if len(feeds) > 0 {
+		rows = modelRows(feeds...)
+	}
+	mock.ExpectQuery(query("GetFollowedFeeds")).
+		WithArgs(user.ID).
+		WillReturnRows(rows)
+}
+
+func TestFeverMarkFeedRead(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := feverUser()
+	feed := database.Feed{ID: uuid.New(), Name: "Blog", Seq: 7}
+	before := time.Unix(1700000000, 0).UTC()
+	state := database.PostState{UserID: user.ID, PostID: uuid.New(), Read: true}
+
+	expectFeverAuth(mock, user, feed)
+	mock.ExpectQuery(query("GetFeedBySeq")).
+		WithArgs(feed.Seq).
+		WillReturnRows(modelRows(feed))
+	// One statement marks everything, comparing before against the publish
+	// times items report as created_on_time.
+	mock.ExpectQuery(query("MarkPostsReadBefore")).
+		WithArgs(timeNear{time.Now()}, user.ID, feed.ID, true, before).
+		WillReturnRows(modelRows(state))
+	mock.ExpectQuery(query("GetUnreadPostSeqs")).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}))
+
+	events, unsubscribe := cfg.Events.subscribe()
+	defer unsubscribe()
+
+	w := httptest.NewRecorder()
+	cfg.feverHandler(w, feverRequest("", url.Values{
+		"api_key": {user.FeverApiKey.String},
+		"mark":    {"feed"},
+		"as":      {"read"},
+		"id":      {"7"},
+		"before":  {"1700000000"},
+	}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	select {
+	case e := <-events:
+		if e.State == nil || e.State.PostID != state.PostID {
+			t.Errorf("event = %+v, want the new state", e)
+		}
+	default:
+		t.Error("state change wasn't published")
+	}
+}
+
+func TestFeverAuth(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := feverUser()
+	mock.ExpectQuery(query("GetUserByFeverAPIKey")).
+		WithArgs(feverAPIKey("ada", "battery staple")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	expectFeverAuth(mock, user)
+
+	for _, tt := range []struct {
+		name     string
+		apiKey   string
+		wantAuth int
+	}{
+		// Without a key there's nothing to look up.
+		{"no key", "", 0},
+		{"wrong key", feverAPIKey("ada", "battery staple"), 0},
+		// Keys are hex, and some clients send them upper case.
+		{"right key", strings.ToUpper(user.FeverApiKey.String), 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			cfg.feverHandler(w, feverRequest("", url.Values{"api_key": {tt.apiKey}}))
+
+			var res struct {
+				APIVersion int `json:"api_version"`
+				Auth       int `json:"auth"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Auth != tt.wantAuth || res.APIVersion != feverAPIVersion {
+				t.Errorf("got %+v, want auth %d", res, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestFeverItemsPaging(t *testing.T) {
+	feed := database.Feed{ID: uuid.New(), Name: "Blog", Seq: 7}
+	tests := []struct {
+		name           string
+		query          string
+		minSeq, maxSeq int64
+		newestFirst    bool
+	}{
+		{"latest", "items", 0, math.MaxInt64, true},
+		{"since_id", "items&since_id=42", 42, math.MaxInt64, false},
+		{"max_id", "items&max_id=42", 0, 42, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			user := feverUser()
+			expectFeverAuth(mock, user, feed)
+			mock.ExpectQuery(query("GetClientItems")).
+				WithArgs(user.ID, tt.minSeq, tt.maxSeq, sqlmock.AnyArg(), nil, nil, nil, nil, nil, tt.newestFirst, feverItemsLimit).
+				WillReturnRows(modelRows(database.GetClientItemsRow{ID: uuid.New(), FeedID: feed.ID, Title: "Post", Seq: 43}))
+			mock.ExpectQuery(query("CountClientItems")).
+				WithArgs(user.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(120)))
+
+			w := httptest.NewRecorder()
+			cfg.feverHandler(w, feverRequest(tt.query, url.Values{"api_key": {user.FeverApiKey.String}}))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var res struct {
+				Items      []feverItem `json:"items"`
+				TotalItems int64       `json:"total_items"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Items) != 1 || res.Items[0].ID != 43 || res.Items[0].FeedID != feed.Seq {
+				t.Errorf("items = %+v", res.Items)
+			}
+			if res.TotalItems != 120 {
+				t.Errorf("total_items = %d, want 120", res.TotalItems)
+			}
+		})
+	}
+}
+
+func TestFeverMarkItemSaved(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := feverUser()
+	post := database.Post{ID: uuid.New(), FeedID: uuid.New(), Seq: 43}
+
+	expectFeverAuth(mock, user)
+	mock.ExpectQuery(query("GetPostBySeq")).
+		WithArgs(post.Seq).
+		WillReturnRows(modelRows(post))
+	mock.ExpectQuery(query("UpsertPostState")).
+		WithArgs(isNull{}, true, isNull{}, timeNear{time.Now()}, post.ID, user.ID).
+		WillReturnRows(modelRows(database.PostState{UserID: user.ID, PostID: post.ID, Starred: true}))
+	// The response carries the saved ids so the client can resync.
+	mock.ExpectQuery(query("GetStarredPostSeqs")).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(int64(12)).AddRow(post.Seq))
+
+	w := httptest.NewRecorder()
+	cfg.feverHandler(w, feverRequest("", url.Values{
+		"api_key": {user.FeverApiKey.String},
+		"mark":    {"item"},
+		"as":      {"saved"},
+		"id":      {"43"},
+	}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var res struct {
+		SavedItemIDs string `json:"saved_item_ids"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.SavedItemIDs != "12,43" {
+		t.Errorf("saved_item_ids = %q, want %q", res.SavedItemIDs, "12,43")
+	}
+}
+
+func TestFeverMarkUnknownItem(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := feverUser()
+	expectFeverAuth(mock, user)
+	mock.ExpectQuery(query("GetPostBySeq")).
+		WithArgs(int64(99)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	w := httptest.NewRecorder()
+	cfg.feverHandler(w, feverRequest("", url.Values{
+		"api_key": {user.FeverApiKey.String},
+		"mark":    {"item"},
+		"as":      {"read"},
+		"id":      {"99"},
+	}))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// maxRulePatternLength keeps rule patterns to a sensible size.
+const maxRulePatternLength = 500
+
+type FilterRule struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	FeedID    *uuid.UUID `json:"feed_id"`
+	Field     string     `json:"field"`
+	MatchType string     `json:"match_type"`
+	Pattern   string     `json:"pattern"`
+	Action    string     `json:"action"`
+	TagName   *string    `json:"tag_name"`
+	Enabled   bool       `json:"enabled"`
+}
+
+func databaseFilterRuleToFilterRule(rule database.FilterRule) FilterRule {
+	return FilterRule{
+		ID:        rule.ID,
+		CreatedAt: rule.CreatedAt,
+		UpdatedAt: rule.UpdatedAt,
+		FeedID:    nullUUIDPtr(rule.FeedID),
+		Field:     rule.Field,
+		MatchType: rule.MatchType,
+		Pattern:   rule.Pattern,
+		Action:    rule.Action,
+		TagName:   nullStringPtr(rule.TagName),
+		Enabled:   rule.Enabled,
+	}
+}
+
+func (cfg *apiConfig) createFilterRuleHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		FeedID    *uuid.UUID `json:"feed_id"`
+		Field     string     `json:"field"`
+		MatchType string     `json:"match_type"`
+		Pattern   string     `json:"pattern"`
+		Action    string     `json:"action"`
+		TagName   string     `json:"tag_name"`
+		Enabled   *bool      `json:"enabled"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	if params.Field == "" {
+		params.Field = ruleFieldAny
+	}
+	if params.MatchType == "" {
+		params.MatchType = ruleMatchKeyword
+	}
+	switch params.Field {
+	case ruleFieldTitle, ruleFieldDescription, ruleFieldAuthor, ruleFieldAny:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid field")
+		return
+	}
+	switch params.Action {
+	case ruleActionHide, ruleActionMarkRead, ruleActionStar, ruleActionNotify:
+		params.TagName = ""
+	case ruleActionTag:
+		params.TagName = strings.TrimSpace(params.TagName)
+		if params.TagName == "" {
+			respondWithError(w, http.StatusBadRequest, "tag_name is required for tag rules")
+			return
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+	if len(params.Pattern) > maxRulePatternLength {
+		respondWithError(w, http.StatusBadRequest, "Pattern is too long")
+		return
+	}
+	feedID := uuid.NullUUID{}
+	if params.FeedID != nil {
+		feedID = uuid.NullUUID{UUID: *params.FeedID, Valid: true}
+	}
+	enabled := true
+	if params.Enabled != nil {
+		enabled = *params.Enabled
+	}
+
+	ruleParams := database.CreateFilterRuleParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feedID,
+		Field:     params.Field,
+		MatchType: params.MatchType,
+		Pattern:   params.Pattern,
+		Action:    params.Action,
+		TagName:   toNullString(params.TagName),
+		Enabled:   enabled,
+	}
+	// Compile the rule up front so bad patterns are rejected now rather
+	// than skipped at ingestion.
+	_, err = newFilterMatcher(database.FilterRule{
+		MatchType: ruleParams.MatchType,
+		Pattern:   ruleParams.Pattern,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pattern: "+err.Error())
+		return
+	}
+
+	rule, err := cfg.DB.CreateFilterRule(r.Context(), ruleParams)
+	if err != nil {
+		if strings.Contains(err.Error(), "violates foreign key constraint") {
+			respondWithError(w, http.StatusNotFound, "Feed not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create filter rule")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseFilterRuleToFilterRule(rule))
+}
+
+func (cfg *apiConfig) getFilterRulesHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	rules, err := cfg.DB.GetFilterRulesByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get filter rules")
+		return
+	}
+
+	res := make([]FilterRule, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, databaseFilterRuleToFilterRule(rule))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) deleteFilterRuleHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	ruleID, err := uuid.Parse(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid filter rule ID")
+		return
+	}
+
+	err = cfg.DB.DeleteFilterRule(r.Context(), database.DeleteFilterRuleParams{
+		ID:     ruleID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Filter rule could not be deleted")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// applyFilterRuleHandler runs a rule against posts the user already has,
+// for rules created after the posts they're meant to catch.
+func (cfg *apiConfig) applyFilterRuleHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type ApplyResponse struct {
+		Matched int `json:"matched"`
+	}
+
+	ruleID, err := uuid.Parse(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid filter rule ID")
+		return
+	}
+	rule, err := cfg.DB.GetFilterRuleForUser(r.Context(), database.GetFilterRuleForUserParams{
+		ID:     ruleID,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Filter rule not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get filter rule")
+		return
+	}
+
+	matched, err := cfg.applyFilterRuleRetroactively(r.Context(), rule)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't apply filter rule")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ApplyResponse{Matched: matched})
+}
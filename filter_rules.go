@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// Fields a filter rule can match against. "any" matches title,
+// description and authors.
+const (
+	ruleFieldTitle       = "title"
+	ruleFieldDescription = "description"
+	ruleFieldAuthor      = "author"
+	ruleFieldAny         = "any"
+)
+
+// Ways a filter rule can match. keyword patterns are comma-separated
+// lists of case-insensitive substrings, any of which may match.
+const (
+	ruleMatchKeyword = "keyword"
+	ruleMatchRegex   = "regex"
+)
+
+// Filter rule actions.
+const (
+	ruleActionHide     = "hide"
+	ruleActionMarkRead = "mark_read"
+	ruleActionStar     = "star"
+	ruleActionTag      = "tag"
+	ruleActionNotify   = "notify"
+)
+
+// maxRetroactivePosts caps how many existing posts applying a rule
+// retroactively looks at.
+const maxRetroactivePosts = 5000
+
+// filterMatcher is a compiled filter rule.
+type filterMatcher struct {
+	rule     database.FilterRule
+	regex    *regexp.Regexp
+	keywords []string
+}
+
+func newFilterMatcher(rule database.FilterRule) (filterMatcher, error) {
+	matcher := filterMatcher{rule: rule}
+	switch rule.MatchType {
+	case ruleMatchRegex:
+		re, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return filterMatcher{}, err
+		}
+		matcher.regex = re
+	case ruleMatchKeyword:
+		for _, keyword := range strings.Split(rule.Pattern, ",") {
+			if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+				matcher.keywords = append(matcher.keywords, keyword)
+			}
+		}
+		if len(matcher.keywords) == 0 {
+			return filterMatcher{}, errors.New("no keywords given")
+		}
+	default:
+		return filterMatcher{}, fmt.Errorf("unknown match type %q", rule.MatchType)
+	}
+	return matcher, nil
+}
+
+func (m filterMatcher) matches(post database.Post) bool {
+	var values []string
+	field := m.rule.Field
+	if field == ruleFieldTitle || field == ruleFieldAny {
+		values = append(values, post.Title)
+	}
+	if field == ruleFieldDescription || field == ruleFieldAny {
+		values = append(values, post.TextContent.String)
+	}
+	if field == ruleFieldAuthor || field == ruleFieldAny {
+		values = append(values, post.Authors...)
+	}
+
+	for _, value := range values {
+		if m.regex != nil {
+			if m.regex.MatchString(value) {
+				return true
+			}
+			continue
+		}
+		value = strings.ToLower(value)
+		for _, keyword := range m.keywords {
+			if strings.Contains(value, keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterMatchersForFeed compiles the rules of every user following a feed,
+// so that one fetch of the feed can run them against all of its new posts.
+// Rules that don't compile are logged and skipped.
+func (cfg *apiConfig) filterMatchersForFeed(ctx context.Context, feedID uuid.UUID) []filterMatcher {
+	rules, err := cfg.DB.GetFilterRulesForFeed(ctx, feedID)
+	if err != nil {
+		log.Printf("Couldn't get filter rules for feed %s: %v", feedID, err)
+		return nil
+	}
+	matchers := make([]filterMatcher, 0, len(rules))
+	for _, rule := range rules {
+		matcher, err := newFilterMatcher(rule)
+		if err != nil {
+			log.Printf("Skipping invalid filter rule %s: %v", rule.ID, err)
+			continue
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers
+}
+
+// applyFilterRules runs the matchers from filterMatchersForFeed against a
+// newly ingested post. It returns the users who hid it.
+func (cfg *apiConfig) applyFilterRules(ctx context.Context, matchers []filterMatcher, post database.Post) map[uuid.UUID]bool {
+	hiddenFor := map[uuid.UUID]bool{}
+	for _, matcher := range matchers {
+		if !matcher.matches(post) {
+			continue
+		}
+		rule := matcher.rule
+		if err := cfg.applyFilterAction(ctx, rule, post, true); err != nil {
+			log.Printf("Couldn't apply filter rule %s to post %s: %v", rule.ID, post.Url, err)
+			continue
+		}
+		if rule.Action == ruleActionHide {
+			hiddenFor[rule.UserID] = true
+		}
+	}
+	return hiddenFor
+}
+
+// applyFilterRuleRetroactively runs a rule against the user's existing
+// posts, newest first, and returns how many matched. Notify rules don't
+// notify for old posts.
+func (cfg *apiConfig) applyFilterRuleRetroactively(ctx context.Context, rule database.FilterRule) (int, error) {
+	matcher, err := newFilterMatcher(rule)
+	if err != nil {
+		return 0, err
+	}
+	posts, err := cfg.DB.GetFollowedPosts(ctx, database.GetFollowedPostsParams{
+		UserID: rule.UserID,
+		FeedID: rule.FeedID,
+		Limit:  maxRetroactivePosts,
+	})
+	if err != nil {
+		return 0, err
+	}
+	matched := 0
+	for _, post := range posts {
+		if !matcher.matches(post) {
+			continue
+		}
+		if err := cfg.applyFilterAction(ctx, rule, post, false); err != nil {
+			return matched, err
+		}
+		matched++
+	}
+	return matched, nil
+}
+
+func (cfg *apiConfig) applyFilterAction(ctx context.Context, rule database.FilterRule, post database.Post, notify bool) error {
+	yes := true
+	switch rule.Action {
+	case ruleActionHide:
+		_, err := cfg.setPostState(ctx, rule.UserID, post.ID, postStateChange{Hidden: &yes})
+		return err
+	case ruleActionMarkRead:
+		_, err := cfg.setPostState(ctx, rule.UserID, post.ID, postStateChange{Read: &yes})
+		return err
+	case ruleActionStar:
+		_, err := cfg.setPostState(ctx, rule.UserID, post.ID, postStateChange{Starred: &yes})
+		return err
+	case ruleActionTag:
+		_, err := cfg.tagPost(ctx, rule.UserID, post.ID, rule.TagName.String)
+		return err
+	case ruleActionNotify:
+		if notify {
+			cfg.notifyRuleMatch(ctx, rule, post)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", rule.Action)
+}
+
+// notifyRuleMatch tells the user a notify rule matched: live on their open
+// connections, and by email if they have an enabled digest with a confirmed
+// address and the server can send mail.
+func (cfg *apiConfig) notifyRuleMatch(ctx context.Context, rule database.FilterRule, post database.Post) {
+	cfg.Events.publish(event{Notification: &notification{
+		UserID: rule.UserID,
+		RuleID: rule.ID,
+		Post:   post,
+	}})
+
+	if cfg.Mailer == nil {
+		return
+	}
+	setting, err := cfg.DB.GetDigestSettings(ctx, rule.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't get email address for rule %s: %v", rule.ID, err)
+		return
+	}
+	if !setting.Enabled || !setting.EmailVerifiedAt.Valid {
+		return
+	}
+	summary := post.Summary.String
+	err = cfg.Mailer.send(email{
+		To:      setting.Email,
+		Subject: "New post matching your filter: " + post.Title,
+		Text:    fmt.Sprintf("%s\n%s\n\n%s\n", post.Title, post.Url, summary),
+		HTML: fmt.Sprintf(`<p><a href="%s">%s</a></p><p>%s</p>`,
+			html.EscapeString(post.Url), html.EscapeString(post.Title), html.EscapeString(summary)),
+	})
+	if err != nil {
+		log.Printf("Couldn't email notification for rule %s: %v", rule.ID, err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+func TestFilterMatcher(t *testing.T) {
+	post := database.Post{
+		Title:       "Go 1.22 released",
+		TextContent: sql.NullString{String: "Range over integers and a new HTTP router.", Valid: true},
+		Authors:     []string{"Ada Lovelace", "Grace Hopper"},
+	}
+	tests := []struct {
+		name    string
+		rule    database.FilterRule
+		want    bool
+		wantErr bool
+	}{
+		{"keyword in title", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldTitle, Pattern: "released"}, true, false},
+		{"keyword ignores case", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldTitle, Pattern: "RELEASED"}, true, false},
+		{"keyword list, one matches", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldTitle, Pattern: "rust, zig , go 1.22"}, true, false},
+		{"keyword list, none match", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldTitle, Pattern: "rust,zig"}, false, false},
+		{"keyword list with blanks", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldTitle, Pattern: " , released,"}, true, false},
+		{"empty keyword list", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldTitle, Pattern: " , ,"}, false, true},
+		{"title rule ignores description", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldTitle, Pattern: "router"}, false, false},
+		{"description", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldDescription, Pattern: "router"}, true, false},
+		{"description rule ignores title", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldDescription, Pattern: "released"}, false, false},
+		{"author", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldAuthor, Pattern: "hopper"}, true, false},
+		{"author rule ignores title", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldAuthor, Pattern: "go"}, false, false},
+		{"any covers title", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldAny, Pattern: "released"}, true, false},
+		{"any covers description", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldAny, Pattern: "integers"}, true, false},
+		{"any covers authors", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldAny, Pattern: "lovelace"}, true, false},
+		{"any, no match", database.FilterRule{MatchType: ruleMatchKeyword, Field: ruleFieldAny, Pattern: "babbage"}, false, false},
+		{"regex", database.FilterRule{MatchType: ruleMatchRegex, Field: ruleFieldTitle, Pattern: `^go \d+\.\d+`}, true, false},
+		{"regex on authors", database.FilterRule{MatchType: ruleMatchRegex, Field: ruleFieldAuthor, Pattern: `^grace`}, true, false},
+		{"regex, no match", database.FilterRule{MatchType: ruleMatchRegex, Field: ruleFieldTitle, Pattern: `^released`}, false, false},
+		{"invalid regex", database.FilterRule{MatchType: ruleMatchRegex, Field: ruleFieldTitle, Pattern: `go (1\.22`}, false, true},
+		{"unknown match type", database.FilterRule{MatchType: "glob", Field: ruleFieldTitle, Pattern: "go*"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := newFilterMatcher(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newFilterMatcher error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := matcher.matches(post); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngestFeedLoadsFilterRulesOnce(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	feed := database.Feed{ID: uuid.New(), Name: "Blog", Url: "https://blog.example/feed"}
+	rule := database.FilterRule{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		MatchType: ruleMatchKeyword,
+		Field:     ruleFieldTitle,
+		Pattern:   "post",
+		Action:    ruleActionNotify,
+	}
+	invalid := database.FilterRule{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		MatchType: ruleMatchRegex,
+		Field:     ruleFieldTitle,
+		Pattern:   "(",
+		Action:    ruleActionNotify,
+	}
+
+	var feedData RSSFeed
+	err := xml.Unmarshal([]byte(`<rss><channel><title>Blog</title><link>https://blog.example/</link>
+<item><title>First post</title><link>https://blog.example/first</link></item>
+<item><title>Second post</title><link>https://blog.example/second</link></item>
+</channel></rss>`), &feedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := []database.Post{
+		{ID: uuid.New(), FeedID: feed.ID, Title: "First post", Url: "https://blog.example/first"},
+		{ID: uuid.New(), FeedID: feed.ID, Title: "Second post", Url: "https://blog.example/second"},
+	}
+
+	mock.ExpectExec(query("UpdateFeedMetadata")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for i, post := range posts {
+		mock.ExpectQuery(query("CreatePost")).
+			WillReturnRows(modelRows(post))
+		mock.ExpectQuery(query("GetClusterByURL")).
+			WithArgs(post.Url, feed.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"cluster_id"}))
+		if i == 0 {
+			mock.ExpectQuery(query("GetFilterRulesForFeed")).
+				WithArgs(feed.ID).
+				WillReturnRows(modelRows(invalid, rule))
+		}
+		mock.ExpectQuery(query("GetWebhooksForFeed")).
+			WithArgs(feed.ID).
+			WillReturnRows(sqlmock.NewRows(nil))
+	}
+
+	events, unsubscribe := cfg.Events.subscribe()
+	defer unsubscribe()
+	cfg.ingestFeed(context.Background(), feed, &feedData)
+
+	notified := 0
+	for done := false; !done; {
+		select {
+		case e := <-events:
+			if e.Notification != nil {
+				if e.Notification.RuleID != rule.ID {
+					t.Errorf("notified for rule %s, want %s", e.Notification.RuleID, rule.ID)
+				}
+				notified++
+			}
+		case <-time.After(100 * time.Millisecond):
+			done = true
+		}
+	}
+	if notified != len(posts) {
+		t.Errorf("got %d notifications, want %d", notified, len(posts))
+	}
+}
+
+func TestNotifyRuleMatchEmail(t *testing.T) {
+	verified := sql.NullTime{Time: time.Now(), Valid: true}
+	tests := []struct {
+		name     string
+		setting  *database.DigestSetting
+		wantSent bool
+	}{
+		{"enabled and confirmed", &database.DigestSetting{Email: "ada@example.com", Enabled: true, EmailVerifiedAt: verified}, true},
+		{"digest disabled", &database.DigestSetting{Email: "ada@example.com", Enabled: false, EmailVerifiedAt: verified}, false},
+		{"address unconfirmed", &database.DigestSetting{Email: "ada@example.com", Enabled: true}, false},
+		{"no digest", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			mailer := &fakeMailer{}
+			cfg.Mailer = mailer
+			rule := database.FilterRule{ID: uuid.New(), UserID: uuid.New(), Action: ruleActionNotify}
+			post := database.Post{ID: uuid.New(), Title: "Matching post", Url: "https://blog.example/match"}
+
+			rows := sqlmock.NewRows(nil)
+			if tt.setting != nil {
+				tt.setting.UserID = rule.UserID
+				rows = modelRows(*tt.setting)
+			}
+			mock.ExpectQuery(query("GetDigestSettings")).
+				WithArgs(rule.UserID).
+				WillReturnRows(rows)
+
+			cfg.notifyRuleMatch(context.Background(), rule, post)
+
+			if sent := len(mailer.sent) == 1; sent != tt.wantSent {
+				t.Errorf("sent %d emails, want sent %v", len(mailer.sent), tt.wantSent)
+			}
+		})
+	}
+}
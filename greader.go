@@ -0,0 +1,678 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultGReaderItems = 20
+	maxGReaderItems     = 1000
+	greaderItemIDPrefix = "tag:google.com,2005:reader/item/"
+	// greaderAuthLifetime is how long a ClientLogin token is accepted.
+	greaderAuthLifetime = 30 * 24 * time.Hour
+)
+
+// Google Reader streams and tags we support, with the user part of the id
+// stripped. "user/-/state/com.google/read" and "user/<id>/state/..." both
+// normalize to these.
+const (
+	greaderReadingList = "state/com.google/reading-list"
+	greaderRead        = "state/com.google/read"
+	greaderStarred     = "state/com.google/starred"
+)
+
+// greaderRouter serves the subset of the Google Reader API that sync clients
+// rely on. Feeds are identified as "feed/<seq>" and items by post seq, the
+// same ids the Fever API uses. Users log in through ClientLogin with their
+// name and the password set through PUT /v1/users/client_password.
+func (cfg *apiConfig) greaderRouter() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/token", cfg.middlewareGReaderAuth(cfg.greaderTokenHandler))
+	router.Get("/user-info", cfg.middlewareGReaderAuth(cfg.greaderUserInfoHandler))
+	router.Get("/tag/list", cfg.middlewareGReaderAuth(cfg.greaderTagListHandler))
+	router.Get("/subscription/list", cfg.middlewareGReaderAuth(cfg.greaderSubscriptionListHandler))
+	router.Post("/subscription/edit", cfg.middlewareGReaderAuth(cfg.greaderSubscriptionEditHandler))
+	router.Get("/stream/contents", cfg.middlewareGReaderAuth(cfg.greaderStreamContentsHandler))
+	router.Get("/stream/contents/*", cfg.middlewareGReaderAuth(cfg.greaderStreamContentsHandler))
+	router.Get("/stream/items/ids", cfg.middlewareGReaderAuth(cfg.greaderItemIDsHandler))
+	router.Post("/stream/items/contents", cfg.middlewareGReaderAuth(cfg.greaderItemContentsHandler))
+	router.Post("/edit-tag", cfg.middlewareGReaderAuth(cfg.greaderEditTagHandler))
+	router.Post("/mark-all-as-read", cfg.middlewareGReaderAuth(cfg.greaderMarkAllAsReadHandler))
+	return router
+}
+
+// greaderClientLoginHandler exchanges a user name and client password for
+// the token clients send as "Authorization: GoogleLogin auth=<token>".
+// Logins get the user's current token while it's live, so several clients
+// can share it, and a new one once it expires. Changing the client
+// password revokes it.
+func (cfg *apiConfig) greaderClientLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse form")
+		return
+	}
+	name := r.Form.Get("Email")
+	password := r.Form.Get("Passwd")
+
+	user, err := cfg.DB.GetUserByClientLoginName(r.Context(), name)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.ClientPasswordHash.String), []byte(password)) != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	token := user.GreaderAuthToken.String
+	if !user.GreaderAuthToken.Valid || !user.GreaderAuthExpiresAt.Time.After(time.Now().UTC()) {
+		token, err = newSecretToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't issue token")
+			return
+		}
+		_, err = cfg.DB.SetUserGReaderAuthToken(r.Context(), database.SetUserGReaderAuthTokenParams{
+			ID:                   user.ID,
+			GreaderAuthToken:     sql.NullString{String: token, Valid: true},
+			GreaderAuthExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(greaderAuthLifetime), Valid: true},
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't issue token")
+			return
+		}
+	}
+	respondWithText(w, http.StatusOK, fmt.Sprintf("SID=%s\nLSID=%s\nAuth=%s\n", token, token, token))
+}
+
+func (cfg *apiConfig) middlewareGReaderAuth(handler authedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(header, "GoogleLogin auth=")
+		if !ok || token == "" {
+			respondWithError(w, http.StatusUnauthorized, "No auth token found")
+			return
+		}
+
+		user, err := cfg.DB.GetUserByGReaderAuthToken(r.Context(), database.GetUserByGReaderAuthTokenParams{
+			GreaderAuthToken:     sql.NullString{String: token, Valid: true},
+			GreaderAuthExpiresAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid auth token")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+// greaderTokenHandler returns the token clients echo back as T on writes.
+// Writes are already authenticated by header, so it isn't checked.
+func (cfg *apiConfig) greaderTokenHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	respondWithText(w, http.StatusOK, strings.ReplaceAll(user.ID.String(), "-", ""))
+}
+
+func (cfg *apiConfig) greaderUserInfoHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type userInfo struct {
+		UserID        string `json:"userId"`
+		UserName      string `json:"userName"`
+		UserProfileID string `json:"userProfileId"`
+		UserEmail     string `json:"userEmail"`
+	}
+
+	respondWithJSON(w, http.StatusOK, userInfo{
+		UserID:        user.ID.String(),
+		UserName:      user.Name,
+		UserProfileID: user.ID.String(),
+	})
+}
+
+func (cfg *apiConfig) greaderTagListHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type tag struct {
+		ID string `json:"id"`
+	}
+	type tagList struct {
+		Tags []tag `json:"tags"`
+	}
+
+	respondWithJSON(w, http.StatusOK, tagList{Tags: []tag{
+		{ID: "user/-/" + greaderStarred},
+	}})
+}
+
+func (cfg *apiConfig) greaderSubscriptionListHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type subscription struct {
+		ID         string     `json:"id"`
+		Title      string     `json:"title"`
+		Categories []struct{} `json:"categories"`
+		Url        string     `json:"url"`
+		HtmlUrl    string     `json:"htmlUrl"`
+		IconUrl    string     `json:"iconUrl"`
+	}
+	type subscriptionList struct {
+		Subscriptions []subscription `json:"subscriptions"`
+	}
+
+	feeds, err := cfg.DB.GetFollowedFeeds(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feeds")
+		return
+	}
+
+	res := subscriptionList{Subscriptions: make([]subscription, 0, len(feeds))}
+	for _, feed := range feeds {
+		res.Subscriptions = append(res.Subscriptions, subscription{
+			ID:         greaderFeedStreamID(feed),
+			Title:      feed.Name,
+			Categories: []struct{}{},
+			Url:        feed.Url,
+			HtmlUrl:    feed.SiteUrl.String,
+			IconUrl:    feed.ImageUrl.String,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// greaderSubscriptionEditHandler follows (ac=subscribe) or unfollows
+// (ac=unsubscribe) the feeds in s. Subscribing to a URL we don't know yet
+// adds the feed, as POST /v1/feeds does. Stream ids other than feed/ ones
+// are rejected. We have no folders or per-user titles, so ac=edit is
+// accepted and ignored.
+func (cfg *apiConfig) greaderSubscriptionEditHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse form")
+		return
+	}
+
+	for _, streamID := range r.Form["s"] {
+		if !strings.HasPrefix(streamID, "feed/") {
+			respondWithError(w, http.StatusBadRequest, "Invalid stream id")
+			return
+		}
+	}
+
+	action := r.Form.Get("ac")
+	for _, streamID := range r.Form["s"] {
+		switch action {
+		case "subscribe":
+			feed, err := cfg.greaderSubscribe(r.Context(), user, streamID, r.Form.Get("t"))
+			if errors.Is(err, errInvalidFeedURL) || errors.Is(err, errFeedUnavailable) {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err != nil {
+				log.Printf("Couldn't subscribe %s to %s: %v", user.Name, streamID, err)
+				respondWithError(w, http.StatusInternalServerError, "Couldn't subscribe")
+				return
+			}
+			_, err = cfg.DB.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				UserID:    user.ID,
+				FeedID:    feed.ID,
+			})
+			if err != nil && !strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't follow feed")
+				return
+			}
+		case "unsubscribe":
+			feed, err := cfg.greaderFeed(r.Context(), streamID)
+			if err != nil {
+				respondWithError(w, http.StatusNotFound, "Feed not found")
+				return
+			}
+			err = cfg.DB.DeleteFeedFollowByFeed(r.Context(), database.DeleteFeedFollowByFeedParams{
+				UserID: user.ID,
+				FeedID: feed.ID,
+			})
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow feed")
+				return
+			}
+		case "edit":
+		default:
+			respondWithError(w, http.StatusBadRequest, "Invalid action")
+			return
+		}
+	}
+
+	respondWithText(w, http.StatusOK, "OK")
+}
+
+// greaderSubscribe returns the feed for streamID, creating it if it's the
+// URL of a feed we don't have yet.
+func (cfg *apiConfig) greaderSubscribe(ctx context.Context, user database.User, streamID, title string) (database.Feed, error) {
+	feed, err := cfg.greaderFeed(ctx, streamID)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return feed, err
+	}
+	return cfg.createFeed(ctx, user, title, strings.TrimPrefix(streamID, "feed/"))
+}
+
+// greaderFeed looks up the feed a "feed/<seq>" or "feed/<url>" stream id
+// refers to.
+func (cfg *apiConfig) greaderFeed(ctx context.Context, streamID string) (database.Feed, error) {
+	ref, ok := strings.CutPrefix(streamID, "feed/")
+	if !ok {
+		return database.Feed{}, fmt.Errorf("invalid feed stream %q", streamID)
+	}
+	if seq, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return cfg.DB.GetFeedBySeq(ctx, seq)
+	}
+	return cfg.DB.GetFeedByURL(ctx, canonicalFeedURL(ref))
+}
+
+func greaderFeedStreamID(feed database.Feed) string {
+	return "feed/" + strconv.FormatInt(feed.Seq, 10)
+}
+
+// greaderState strips the user part from a stream or tag id, so
+// "user/-/state/com.google/read" becomes "state/com.google/read". Other
+// ids are returned unchanged.
+func greaderState(id string) string {
+	parts := strings.SplitN(id, "/", 3)
+	if len(parts) == 3 && parts[0] == "user" {
+		return parts[2]
+	}
+	return id
+}
+
+// greaderItemsParams builds an item query from the parameters shared by
+// the stream endpoints: s, n, r, c, xt, it, ot and nt.
+func (cfg *apiConfig) greaderItemsParams(ctx context.Context, user database.User, streamID string, query url.Values) (database.GetClientItemsParams, error) {
+	params := database.GetClientItemsParams{
+		UserID:      user.ID,
+		MinSeq:      0,
+		MaxSeq:      math.MaxInt64,
+		Seqs:        []int64{},
+		NewestFirst: query.Get("r") != "o",
+		Limit:       defaultGReaderItems,
+	}
+	if n, err := strconv.Atoi(query.Get("n")); err == nil && n > 0 {
+		params.Limit = int32(min(n, maxGReaderItems))
+	}
+
+	switch state := greaderState(streamID); state {
+	case greaderReadingList:
+	case greaderRead:
+		params.Read = sql.NullBool{Bool: true, Valid: true}
+	case greaderStarred:
+		params.Starred = sql.NullBool{Bool: true, Valid: true}
+	default:
+		feed, err := cfg.greaderFeed(ctx, streamID)
+		if err != nil {
+			return params, fmt.Errorf("unknown stream %q", streamID)
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	for _, target := range query["xt"] {
+		switch greaderState(target) {
+		case greaderRead:
+			params.Read = sql.NullBool{Bool: false, Valid: true}
+		case greaderStarred:
+			params.Starred = sql.NullBool{Bool: false, Valid: true}
+		}
+	}
+	for _, target := range query["it"] {
+		switch greaderState(target) {
+		case greaderRead:
+			params.Read = sql.NullBool{Bool: true, Valid: true}
+		case greaderStarred:
+			params.Starred = sql.NullBool{Bool: true, Valid: true}
+		}
+	}
+	if seconds, err := strconv.ParseInt(query.Get("ot"), 10, 64); err == nil {
+		params.OlderThan = sql.NullTime{Time: time.Unix(seconds, 0).UTC(), Valid: true}
+	}
+	if seconds, err := strconv.ParseInt(query.Get("nt"), 10, 64); err == nil {
+		params.NewerThan = sql.NullTime{Time: time.Unix(seconds, 0).UTC(), Valid: true}
+	}
+
+	// The continuation is the seq of the last item on the previous page.
+	if c, err := strconv.ParseInt(query.Get("c"), 10, 64); err == nil {
+		if params.NewestFirst {
+			params.MaxSeq = c
+		} else {
+			params.MinSeq = c
+		}
+	}
+	return params, nil
+}
+
+// greaderContinuation returns the continuation for the page after rows, or
+// "" if this was the last one.
+func greaderContinuation(rows []database.GetClientItemsRow, limit int32) string {
+	if len(rows) == 0 || len(rows) < int(limit) {
+		return ""
+	}
+	return strconv.FormatInt(rows[len(rows)-1].Seq, 10)
+}
+
+func (cfg *apiConfig) greaderItemIDsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type itemRef struct {
+		ID              string   `json:"id"`
+		DirectStreamIDs []string `json:"directStreamIds"`
+		TimestampUsec   string   `json:"timestampUsec"`
+	}
+	type itemIDs struct {
+		ItemRefs     []itemRef `json:"itemRefs"`
+		Continuation string    `json:"continuation,omitempty"`
+	}
+
+	params, err := cfg.greaderItemsParams(r.Context(), user, r.URL.Query().Get("s"), r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := cfg.DB.GetClientItems(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get items")
+		return
+	}
+
+	res := itemIDs{
+		ItemRefs:     make([]itemRef, 0, len(rows)),
+		Continuation: greaderContinuation(rows, params.Limit),
+	}
+	for _, row := range rows {
+		res.ItemRefs = append(res.ItemRefs, itemRef{
+			ID:              strconv.FormatInt(row.Seq, 10),
+			DirectStreamIDs: []string{},
+			TimestampUsec:   strconv.FormatInt(row.CreatedAt.UnixMicro(), 10),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) greaderStreamContentsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	streamID := r.URL.Query().Get("s")
+	if path := chi.URLParam(r, "*"); path != "" {
+		unescaped, err := url.PathUnescape(path)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid stream")
+			return
+		}
+		streamID = unescaped
+	}
+
+	params, err := cfg.greaderItemsParams(r.Context(), user, streamID, r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := cfg.DB.GetClientItems(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get items")
+		return
+	}
+	cfg.respondWithGReaderItems(w, r, user, streamID, rows, greaderContinuation(rows, params.Limit))
+}
+
+// greaderItemContentsHandler returns the items listed in i, in any of the
+// id forms clients send.
+func (cfg *apiConfig) greaderItemContentsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse form")
+		return
+	}
+	seqs, err := parseGReaderItemIDs(r.Form["i"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(seqs) > maxGReaderItems {
+		respondWithError(w, http.StatusBadRequest, "Too many items")
+		return
+	}
+
+	rows := []database.GetClientItemsRow{}
+	if len(seqs) > 0 {
+		rows, err = cfg.DB.GetClientItems(r.Context(), database.GetClientItemsParams{
+			UserID:      user.ID,
+			MinSeq:      0,
+			MaxSeq:      math.MaxInt64,
+			Seqs:        seqs,
+			NewestFirst: true,
+			Limit:       int32(len(seqs)),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get items")
+			return
+		}
+	}
+	cfg.respondWithGReaderItems(w, r, user, "user/-/"+greaderReadingList, rows, "")
+}
+
+func (cfg *apiConfig) respondWithGReaderItems(w http.ResponseWriter, r *http.Request, user database.User, streamID string, rows []database.GetClientItemsRow, continuation string) {
+	type link struct {
+		Href string `json:"href"`
+		Type string `json:"type,omitempty"`
+	}
+	type content struct {
+		Direction string `json:"direction"`
+		Content   string `json:"content"`
+	}
+	type origin struct {
+		StreamID string `json:"streamId"`
+		Title    string `json:"title"`
+		HtmlUrl  string `json:"htmlUrl"`
+	}
+	type item struct {
+		ID            string   `json:"id"`
+		CrawlTimeMsec string   `json:"crawlTimeMsec"`
+		TimestampUsec string   `json:"timestampUsec"`
+		Published     int64    `json:"published"`
+		Updated       int64    `json:"updated"`
+		Title         string   `json:"title"`
+		Author        string   `json:"author,omitempty"`
+		Canonical     []link   `json:"canonical"`
+		Alternate     []link   `json:"alternate"`
+		Summary       content  `json:"summary"`
+		Categories    []string `json:"categories"`
+		Origin        origin   `json:"origin"`
+	}
+	type streamContents struct {
+		Direction    string `json:"direction"`
+		ID           string `json:"id"`
+		Updated      int64  `json:"updated"`
+		Items        []item `json:"items"`
+		Continuation string `json:"continuation,omitempty"`
+	}
+
+	feeds, err := cfg.DB.GetFollowedFeeds(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feeds")
+		return
+	}
+	feedsByID := make(map[uuid.UUID]database.Feed, len(feeds))
+	for _, feed := range feeds {
+		feedsByID[feed.ID] = feed
+	}
+
+	res := streamContents{
+		Direction:    "ltr",
+		ID:           streamID,
+		Updated:      time.Now().Unix(),
+		Items:        make([]item, 0, len(rows)),
+		Continuation: continuation,
+	}
+	for _, row := range rows {
+		post := databasePostToPost(clientItemPost(row), nil, postFormatHTML)
+		published := row.CreatedAt
+		if row.PublishedAt.Valid {
+			published = row.PublishedAt.Time
+		}
+		categories := []string{"user/-/" + greaderReadingList}
+		if row.IsRead {
+			categories = append(categories, "user/-/"+greaderRead)
+		}
+		if row.IsStarred {
+			categories = append(categories, "user/-/"+greaderStarred)
+		}
+		feed := feedsByID[row.FeedID]
+		res.Items = append(res.Items, item{
+			ID:            fmt.Sprintf("%s%016x", greaderItemIDPrefix, row.Seq),
+			CrawlTimeMsec: strconv.FormatInt(row.CreatedAt.UnixMilli(), 10),
+			TimestampUsec: strconv.FormatInt(row.CreatedAt.UnixMicro(), 10),
+			Published:     published.Unix(),
+			Updated:       row.UpdatedAt.Unix(),
+			Title:         row.Title,
+			Author:        strings.Join(row.Authors, ", "),
+			Canonical:     []link{{Href: row.Url}},
+			Alternate:     []link{{Href: row.Url, Type: "text/html"}},
+			Summary:       content{Direction: "ltr", Content: deref(post.Body)},
+			Categories:    categories,
+			Origin: origin{
+				StreamID: greaderFeedStreamID(feed),
+				Title:    feed.Name,
+				HtmlUrl:  feed.SiteUrl.String,
+			},
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// greaderEditTagHandler adds (a) and removes (r) the read and starred tags
+// on the items in i. Other tags are ignored.
+func (cfg *apiConfig) greaderEditTagHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse form")
+		return
+	}
+	seqs, err := parseGReaderItemIDs(r.Form["i"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(seqs) > maxGReaderItems {
+		respondWithError(w, http.StatusBadRequest, "Too many items")
+		return
+	}
+
+	change := postStateChange{}
+	yes, no := true, false
+	for _, tag := range r.Form["a"] {
+		switch greaderState(tag) {
+		case greaderRead:
+			change.Read = &yes
+		case greaderStarred:
+			change.Starred = &yes
+		}
+	}
+	for _, tag := range r.Form["r"] {
+		switch greaderState(tag) {
+		case greaderRead:
+			change.Read = &no
+		case greaderStarred:
+			change.Starred = &no
+		}
+	}
+
+	if change.Read != nil || change.Starred != nil {
+		for _, seq := range seqs {
+			post, err := cfg.DB.GetPostBySeq(r.Context(), seq)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't get item")
+				return
+			}
+			_, err = cfg.setPostState(r.Context(), user.ID, post.ID, change)
+			if errors.Is(err, errPostNotFound) {
+				continue
+			}
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't update item")
+				return
+			}
+		}
+	}
+
+	respondWithText(w, http.StatusOK, "OK")
+}
+
+// greaderMarkAllAsReadHandler marks everything in stream s read, up to ts
+// in microseconds if given.
+func (cfg *apiConfig) greaderMarkAllAsReadHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse form")
+		return
+	}
+
+	before := time.Now().UTC()
+	if usec, err := strconv.ParseInt(r.Form.Get("ts"), 10, 64); err == nil {
+		before = time.UnixMicro(usec).UTC()
+	}
+
+	streamID := r.Form.Get("s")
+	feedID := uuid.NullUUID{}
+	if greaderState(streamID) != greaderReadingList {
+		feed, err := cfg.greaderFeed(r.Context(), streamID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Unsupported stream")
+			return
+		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	// ts is in the same terms as the timestampUsec items report: when we
+	// ingested them.
+	if err := cfg.markPostsRead(r.Context(), user, feedID, before, false); err != nil {
+		log.Printf("Couldn't mark stream %s read: %v", streamID, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't mark items read")
+		return
+	}
+
+	respondWithText(w, http.StatusOK, "OK")
+}
+
+// parseGReaderItemIDs parses item ids in the long form
+// "tag:google.com,2005:reader/item/<16 hex digits>" or the short decimal
+// form, both of which encode the post seq.
+func parseGReaderItemIDs(ids []string) ([]int64, error) {
+	seqs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		var seq int64
+		var err error
+		if hexID, ok := strings.CutPrefix(id, greaderItemIDPrefix); ok {
+			var u uint64
+			u, err = strconv.ParseUint(hexID, 16, 64)
+			seq = int64(u)
+		} else {
+			seq, err = strconv.ParseInt(id, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid item id %q", id)
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs, nil
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// captureString matches any string argument and records it.
+type captureString struct {
+	got *string
+}
+
+func (m captureString) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*m.got = s
+	return ok
+}
+
+func greaderUser(t *testing.T) database.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database.User{
+		ID:                 uuid.New(),
+		Name:               "ada",
+		ClientPasswordHash: sql.NullString{String: string(hash), Valid: true},
+	}
+}
+
+func greaderLoginRequest(name, password string) *http.Request {
+	form := url.Values{"Email": {name}, "Passwd": {password}}
+	r := httptest.NewRequest(http.MethodPost, "/accounts/ClientLogin", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+var greaderAuthLine = regexp.MustCompile(`(?m)^Auth=([0-9a-f]+)$`)
+
+func TestGReaderClientLogin(t *testing.T) {
+	t.Run("issues a random token", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		user := greaderUser(t)
+		var issued string
+		mock.ExpectQuery(query("GetUserByClientLoginName")).
+			WithArgs("ada").
+			WillReturnRows(modelRows(user))
+		mock.ExpectQuery(query("SetUserGReaderAuthToken")).
+			WithArgs(user.ID, captureString{&issued}, timeNear{time.Now().Add(greaderAuthLifetime)}).
+			WillReturnRows(modelRows(user))
+
+		w := httptest.NewRecorder()
+		cfg.greaderClientLoginHandler(w, greaderLoginRequest("ada", "correct horse"))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		m := greaderAuthLine.FindStringSubmatch(w.Body.String())
+		if m == nil || m[1] != issued {
+			t.Fatalf("body = %q, want Auth=%s", w.Body, issued)
+		}
+		if len(issued) != 64 {
+			t.Errorf("token %q isn't 32 random bytes", issued)
+		}
+	})
+
+	t.Run("reuses a live token", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		user := greaderUser(t)
+		user.GreaderAuthToken = sql.NullString{String: "0123abcd", Valid: true}
+		user.GreaderAuthExpiresAt = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+		mock.ExpectQuery(query("GetUserByClientLoginName")).
+			WithArgs("ada").
+			WillReturnRows(modelRows(user))
+
+		w := httptest.NewRecorder()
+		cfg.greaderClientLoginHandler(w, greaderLoginRequest("ada", "correct horse"))
+
+		if m := greaderAuthLine.FindStringSubmatch(w.Body.String()); m == nil || m[1] != "0123abcd" {
+			t.Errorf("body = %q, want the live token", w.Body)
+		}
+	})
+
+	t.Run("replaces an expired token", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		user := greaderUser(t)
+		user.GreaderAuthToken = sql.NullString{String: "0123abcd", Valid: true}
+		user.GreaderAuthExpiresAt = sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+		var issued string
+		mock.ExpectQuery(query("GetUserByClientLoginName")).
+			WithArgs("ada").
+			WillReturnRows(modelRows(user))
+		mock.ExpectQuery(query("SetUserGReaderAuthToken")).
+			WithArgs(user.ID, captureString{&issued}, timeNear{time.Now().Add(greaderAuthLifetime)}).
+			WillReturnRows(modelRows(user))
+
+		w := httptest.NewRecorder()
+		cfg.greaderClientLoginHandler(w, greaderLoginRequest("ada", "correct horse"))
+
+		if issued == "0123abcd" {
+			t.Error("expired token was reissued")
+		}
+		if m := greaderAuthLine.FindStringSubmatch(w.Body.String()); m == nil || m[1] != issued {
+			t.Errorf("body = %q, want Auth=%s", w.Body, issued)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		user := greaderUser(t)
+		mock.ExpectQuery(query("GetUserByClientLoginName")).
+			WithArgs("ada").
+			WillReturnRows(modelRows(user))
+
+		w := httptest.NewRecorder()
+		cfg.greaderClientLoginHandler(w, greaderLoginRequest("ada", "battery staple"))
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(query("GetUserByClientLoginName")).
+			WithArgs("bob").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		w := httptest.NewRecorder()
+		cfg.greaderClientLoginHandler(w, greaderLoginRequest("bob", "correct horse"))
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestMiddlewareGReaderAuth(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := greaderUser(t)
+	mock.ExpectQuery(query("GetUserByGReaderAuthToken")).
+		WithArgs("0123abcd", timeNear{time.Now()}).
+		WillReturnRows(modelRows(user))
+	// The query only matches tokens that haven't expired.
+	mock.ExpectQuery(query("GetUserByGReaderAuthToken")).
+		WithArgs("expired", timeNear{time.Now()}).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	var got uuid.UUID
+	handler := cfg.middlewareGReaderAuth(func(w http.ResponseWriter, r *http.Request, user database.User) {
+		got = user.ID
+	})
+	for _, tt := range []struct {
+		header     string
+		wantStatus int
+	}{
+		{"GoogleLogin auth=0123abcd", http.StatusOK},
+		{"GoogleLogin auth=expired", http.StatusUnauthorized},
+		{"Bearer 0123abcd", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/reader/api/0/token", nil)
+		r.Header.Set("Authorization", tt.header)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.header, w.Code, tt.wantStatus)
+		}
+	}
+	if got != user.ID {
+		t.Errorf("handler got user %s, want %s", got, user.ID)
+	}
+}
+
+func TestGReaderStreamContentsPaging(t *testing.T) {
+	user := database.User{ID: uuid.New()}
+	feed := database.Feed{ID: uuid.New(), Name: "Blog", Seq: 3}
+	rows := []interface{}{
+		database.GetClientItemsRow{ID: uuid.New(), FeedID: feed.ID, Title: "Nine", Seq: 9},
+		database.GetClientItemsRow{ID: uuid.New(), FeedID: feed.ID, Title: "Eight", Seq: 8},
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		minSeq, maxSeq   int64
+		newestFirst      bool
+		wantContinuation string
+	}{
+		{"first page", "n=2", 0, math.MaxInt64, true, "8"},
+		{"newest first continuation", "n=2&c=10", 0, 10, true, "8"},
+		{"oldest first continuation", "n=2&r=o&c=7", 7, math.MaxInt64, false, "8"},
+		{"last page", "n=3", 0, math.MaxInt64, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			limit := 2
+			if strings.Contains(tt.query, "n=3") {
+				limit = 3
+			}
+			mock.ExpectQuery(query("GetClientItems")).
+				WithArgs(user.ID, tt.minSeq, tt.maxSeq, sqlmock.AnyArg(), nil, nil, nil, nil, nil, tt.newestFirst, limit).
+				WillReturnRows(modelRows(rows...))
+			mock.ExpectQuery(query("GetFollowedFeeds")).
+				WithArgs(user.ID).
+				WillReturnRows(modelRows(feed))
+
+			r := httptest.NewRequest(http.MethodGet, "/reader/api/0/stream/contents?s=user/-/state/com.google/reading-list&"+tt.query, nil)
+			w := httptest.NewRecorder()
+			cfg.greaderStreamContentsHandler(w, r, user)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var res struct {
+				Items []struct {
+					ID     string `json:"id"`
+					Origin struct {
+						StreamID string `json:"streamId"`
+					} `json:"origin"`
+				} `json:"items"`
+				Continuation string `json:"continuation"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Continuation != tt.wantContinuation {
+				t.Errorf("continuation = %q, want %q", res.Continuation, tt.wantContinuation)
+			}
+			if len(res.Items) != 2 || res.Items[0].ID != greaderItemIDPrefix+"0000000000000009" {
+				t.Errorf("items = %+v", res.Items)
+			}
+			if len(res.Items) > 0 && res.Items[0].Origin.StreamID != "feed/3" {
+				t.Errorf("origin = %q, want feed/3", res.Items[0].Origin.StreamID)
+			}
+		})
+	}
+}
+
+func TestGReaderEditTag(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New()}
+	post := database.Post{ID: uuid.New(), FeedID: uuid.New(), Seq: 10}
+	unfollowed := database.Post{ID: uuid.New(), FeedID: uuid.New(), Seq: 11}
+
+	mock.ExpectQuery(query("GetPostBySeq")).
+		WithArgs(int64(10)).
+		WillReturnRows(modelRows(post))
+	mock.ExpectQuery(query("UpsertPostState")).
+		WithArgs(true, false, isNull{}, timeNear{time.Now()}, post.ID, user.ID).
+		WillReturnRows(modelRows(database.PostState{UserID: user.ID, PostID: post.ID, Read: true}))
+	mock.ExpectQuery(query("GetPostBySeq")).
+		WithArgs(int64(11)).
+		WillReturnRows(modelRows(unfollowed))
+	mock.ExpectQuery(query("UpsertPostState")).
+		WithArgs(true, false, isNull{}, timeNear{time.Now()}, unfollowed.ID, user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	// Items come as long-form ids, short decimal ids or bare hex.
+	form := url.Values{
+		"i": {greaderItemIDPrefix + "000000000000000a", "11"},
+		"a": {"user/-/state/com.google/read"},
+		"r": {"user/-/state/com.google/starred"},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/reader/api/0/edit-tag", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	cfg.greaderEditTagHandler(w, r, user)
+
+	if w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Errorf("status = %d, body = %q", w.Code, w.Body)
+	}
+}
+
+func TestGReaderEditTagTooManyItems(t *testing.T) {
+	cfg, _ := newMockConfig(t)
+	form := url.Values{"a": {"user/-/state/com.google/read"}}
+	for i := 0; i <= maxGReaderItems; i++ {
+		form.Add("i", strconv.Itoa(i+1))
+	}
+	r := httptest.NewRequest(http.MethodPost, "/reader/api/0/edit-tag", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	cfg.greaderEditTagHandler(w, r, database.User{ID: uuid.New()})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGReaderSubscriptionEditRejectsOtherStreams(t *testing.T) {
+	for _, action := range []string{"subscribe", "unsubscribe"} {
+		for _, streamID := range []string{"user/-/label/Tech", "https://blog.example/feed", ""} {
+			t.Run(action+" "+streamID, func(t *testing.T) {
+				cfg, _ := newMockConfig(t)
+				form := url.Values{"ac": {action}, "s": {"feed/1", streamID}}
+				r := httptest.NewRequest(http.MethodPost, "/reader/api/0/subscription/edit", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				w := httptest.NewRecorder()
+				cfg.greaderSubscriptionEditHandler(w, r, database.User{ID: uuid.New()})
+
+				// Nothing is changed, including the valid stream before it.
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+				}
+			})
+		}
+	}
+}
+
+func TestGReaderSubscribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss><channel><title>Blog</title></channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	subscribe := func(cfg *apiConfig, user database.User, streamID string) *httptest.ResponseRecorder {
+		form := url.Values{"ac": {"subscribe"}, "s": {streamID}}
+		r := httptest.NewRequest(http.MethodPost, "/reader/api/0/subscription/edit", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		cfg.greaderSubscriptionEditHandler(w, r, user)
+		return w
+	}
+
+	t.Run("new feed", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		user := database.User{ID: uuid.New()}
+		feedURL := server.URL + "/feed"
+		feed := database.Feed{ID: uuid.New(), Name: "Blog", Url: feedURL}
+		// Looked up and stored in canonical form.
+		mock.ExpectQuery(query("GetFeedByURL")).
+			WithArgs(feedURL).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(query("CreateFeed")).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "Blog", feedURL, user.ID).
+			WillReturnRows(modelRows(feed))
+		mock.ExpectQuery(query("CreateFeedFollow")).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, feed.ID).
+			WillReturnRows(modelRows(database.FeedFollow{ID: uuid.New(), UserID: user.ID, FeedID: feed.ID}))
+
+		w := subscribe(cfg, user, "feed/"+server.URL+"/feed?utm_source=reader#top")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(query("GetFeedByURL")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		w := subscribe(cfg, database.User{ID: uuid.New()}, "feed/ftp://files.example/feed")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("fetch fails", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(query("GetFeedByURL")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		w := subscribe(cfg, database.User{ID: uuid.New()}, "feed/"+unreachable.URL+"/feed")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		// Why the fetch failed says things about our network.
+		u, _ := url.Parse(unreachable.URL)
+		if body := w.Body.String(); strings.Contains(body, u.Port()) || strings.Contains(body, "refused") {
+			t.Errorf("body leaks the fetch error: %s", body)
+		}
+	})
+}
@@ -60,6 +60,21 @@ func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowPara
 	return err
 }
 
+const deleteFeedFollowByFeed = `-- name: DeleteFeedFollowByFeed :exec
+DELETE FROM feed_follows
+WHERE user_id = $1 AND feed_id = $2
+`
+
+type DeleteFeedFollowByFeedParams struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
+}
+
+func (q *Queries) DeleteFeedFollowByFeed(ctx context.Context, arg DeleteFeedFollowByFeedParams) error {
+	_, err := q.db.ExecContext(ctx, deleteFeedFollowByFeed, arg.UserID, arg.FeedID)
+	return err
+}
+
 const getFeedFollows = `-- name: GetFeedFollows :many
 SELECT id, created_at, updated_at, user_id, feed_id FROM feed_follows WHERE user_id = $1
 `
@@ -92,3 +107,22 @@ func (q *Queries) GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]FeedF
 	}
 	return items, nil
 }
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = $1, updated_at = NOW()
+WHERE feed_id = $2
+AND user_id NOT IN (
+  SELECT user_id FROM feed_follows WHERE feed_id = $1
+)
+`
+
+type MoveFeedFollowsParams struct {
+	NewFeedID uuid.UUID
+	OldFeedID uuid.UUID
+}
+
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.NewFeedID, arg.OldFeedID)
+	return err
+}
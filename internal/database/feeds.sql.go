@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,7 +16,7 @@ import (
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
 VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, redirect_url, redirect_count, dead_at, last_error, site_url, description, language, image_url, generator, extract_full_content, seq
 `
 
 type CreateFeedParams struct {
@@ -45,12 +46,92 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.DeadAt,
+		&i.LastError,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.ExtractFullContent,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const getFeedByID = `-- name: GetFeedByID :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, redirect_url, redirect_count, dead_at, last_error, site_url, description, language, image_url, generator, extract_full_content, seq FROM feeds WHERE id = $1
+`
+
+func (q *Queries) GetFeedByID(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByID, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.DeadAt,
+		&i.LastError,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.ExtractFullContent,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const getFeedByURL = `-- name: GetFeedByURL :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, redirect_url, redirect_count, dead_at, last_error, site_url, description, language, image_url, generator, extract_full_content, seq FROM feeds WHERE url = $1
+`
+
+func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByURL, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.DeadAt,
+		&i.LastError,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.ExtractFullContent,
+		&i.Seq,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at from feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, redirect_url, redirect_count, dead_at, last_error, site_url, description, language, image_url, generator, extract_full_content, seq from feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -70,6 +151,17 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.DeadAt,
+			&i.LastError,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+			&i.ExtractFullContent,
+			&i.Seq,
 		); err != nil {
 			return nil, err
 		}
@@ -85,7 +177,15 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 }
 
 const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, redirect_url, redirect_count, dead_at, last_error, site_url, description, language, image_url, generator, extract_full_content, seq FROM feeds
+WHERE dead_at IS NULL
+AND NOT EXISTS (
+  SELECT 1 FROM websub_subscriptions
+  WHERE websub_subscriptions.feed_id = feeds.id
+  AND websub_subscriptions.state = 'active'
+  AND websub_subscriptions.lease_expires_at > NOW()
+  AND feeds.last_fetched_at > NOW() - INTERVAL '1 day'
+)
 ORDER BY last_fetched_at NULLS FIRST
 LIMIT $1
 `
@@ -107,6 +207,17 @@ func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed,
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.DeadAt,
+			&i.LastError,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+			&i.ExtractFullContent,
+			&i.Seq,
 		); err != nil {
 			return nil, err
 		}
@@ -121,11 +232,22 @@ func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed,
 	return items, nil
 }
 
+const markFeedDead = `-- name: MarkFeedDead :exec
+UPDATE feeds
+SET dead_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) MarkFeedDead(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markFeedDead, id)
+	return err
+}
+
 const markFeedFetched = `-- name: MarkFeedFetched :one
 UPDATE feeds 
 SET last_fetched_at = NOW(), updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, redirect_url, redirect_count, dead_at, last_error, site_url, description, language, image_url, generator, extract_full_content, seq
 `
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
@@ -139,6 +261,156 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.DeadAt,
+		&i.LastError,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.ExtractFullContent,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const requestFeedRefetch = `-- name: RequestFeedRefetch :execrows
+UPDATE feeds
+SET last_fetched_at = NULL, updated_at = NOW()
+WHERE id = $1 AND last_fetched_at < $2
+`
+
+type RequestFeedRefetchParams struct {
+	ID            uuid.UUID
+	FetchedBefore sql.NullTime
+}
+
+func (q *Queries) RequestFeedRefetch(ctx context.Context, arg RequestFeedRefetchParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requestFeedRefetch, arg.ID, arg.FetchedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setFeedError = `-- name: SetFeedError :exec
+UPDATE feeds
+SET last_error = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetFeedErrorParams struct {
+	ID        uuid.UUID
+	LastError sql.NullString
+}
+
+func (q *Queries) SetFeedError(ctx context.Context, arg SetFeedErrorParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedError, arg.ID, arg.LastError)
+	return err
+}
+
+const setFeedExtractFullContent = `-- name: SetFeedExtractFullContent :one
+UPDATE feeds
+SET extract_full_content = $2, updated_at = NOW()
+WHERE id = $1 AND user_id = $3
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, redirect_url, redirect_count, dead_at, last_error, site_url, description, language, image_url, generator, extract_full_content, seq
+`
+
+type SetFeedExtractFullContentParams struct {
+	ID                 uuid.UUID
+	ExtractFullContent bool
+	UserID             uuid.UUID
+}
+
+func (q *Queries) SetFeedExtractFullContent(ctx context.Context, arg SetFeedExtractFullContentParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedExtractFullContent, arg.ID, arg.ExtractFullContent, arg.UserID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.DeadAt,
+		&i.LastError,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.ExtractFullContent,
+		&i.Seq,
 	)
 	return i, err
 }
+
+const setFeedRedirect = `-- name: SetFeedRedirect :exec
+UPDATE feeds
+SET redirect_url = $2, redirect_count = $3, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetFeedRedirectParams struct {
+	ID            uuid.UUID
+	RedirectUrl   sql.NullString
+	RedirectCount int32
+}
+
+func (q *Queries) SetFeedRedirect(ctx context.Context, arg SetFeedRedirectParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRedirect, arg.ID, arg.RedirectUrl, arg.RedirectCount)
+	return err
+}
+
+const updateFeedMetadata = `-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET site_url = $2,
+  description = $3,
+  language = $4,
+  image_url = $5,
+  generator = $6,
+  updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedMetadataParams struct {
+	ID          uuid.UUID
+	SiteUrl     sql.NullString
+	Description sql.NullString
+	Language    sql.NullString
+	ImageUrl    sql.NullString
+	Generator   sql.NullString
+}
+
+func (q *Queries) UpdateFeedMetadata(ctx context.Context, arg UpdateFeedMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedMetadata,
+		arg.ID,
+		arg.SiteUrl,
+		arg.Description,
+		arg.Language,
+		arg.ImageUrl,
+		arg.Generator,
+	)
+	return err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :exec
+UPDATE feeds
+SET url = $2, redirect_url = NULL, redirect_count = 0, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedURLParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedURL, arg.ID, arg.Url)
+	return err
+}
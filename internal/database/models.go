@@ -11,14 +11,61 @@ import (
 	"github.com/google/uuid"
 )
 
+type ArticleQueue struct {
+	PostID   uuid.UUID
+	QueuedAt time.Time
+}
+
+type Collection struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	Name        string
+	Slug        string
+	Description sql.NullString
+}
+
+type CollectionPost struct {
+	CollectionID uuid.UUID
+	PostID       uuid.UUID
+	AddedAt      time.Time
+}
+
+type DigestSetting struct {
+	UserID            uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Email             string
+	Frequency         string
+	SendHour          int32
+	Weekday           int32
+	FeedIds           []uuid.UUID
+	Enabled           bool
+	LastSentAt        sql.NullTime
+	EmailVerifiedAt   sql.NullTime
+	VerificationToken sql.NullString
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Name               string
+	Url                string
+	UserID             uuid.UUID
+	LastFetchedAt      sql.NullTime
+	RedirectUrl        sql.NullString
+	RedirectCount      int32
+	DeadAt             sql.NullTime
+	LastError          sql.NullString
+	SiteUrl            sql.NullString
+	Description        sql.NullString
+	Language           sql.NullString
+	ImageUrl           sql.NullString
+	Generator          sql.NullString
+	ExtractFullContent bool
+	Seq                int64
 }
 
 type FeedFollow struct {
@@ -29,21 +76,129 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FilterRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Field     string
+	MatchType string
+	Pattern   string
+	Action    string
+	TagName   sql.NullString
+	Enabled   bool
+}
+
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Title                string
+	Url                  string
+	Description          sql.NullString
+	PublishedAt          sql.NullTime
+	FeedID               uuid.UUID
+	Content              sql.NullString
+	Authors              []string
+	Categories           []string
+	CommentsUrl          sql.NullString
+	ThumbnailUrl         sql.NullString
+	SanitizedDescription sql.NullString
+	SanitizedContent     sql.NullString
+	TextContent          sql.NullString
+	Summary              sql.NullString
+	ArticleContent       sql.NullString
+	ClusterID            uuid.UUID
+	Seq                  int64
 }
 
-type User struct {
+type PostEnclosure struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	PostID          uuid.UUID
+	Url             string
+	Length          sql.NullInt64
+	MimeType        sql.NullString
+	DurationSeconds sql.NullInt32
+	ImageUrl        sql.NullString
+	Season          sql.NullInt32
+	Episode         sql.NullInt32
+}
+
+type PostState struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	Read      bool
+	Starred   bool
+	UpdatedAt time.Time
+	Hidden    bool
+}
+
+type PostTag struct {
+	TagID     uuid.UUID
+	PostID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type Tag struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	UserID    uuid.UUID
 	Name      string
-	ApiKey    string
+}
+
+type User struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Name                 string
+	ApiKey               string
+	FeedToken            string
+	ClientPasswordHash   sql.NullString
+	FeverApiKey          sql.NullString
+	GreaderAuthToken     sql.NullString
+	GreaderAuthExpiresAt sql.NullTime
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	FeedID    uuid.NullUUID
+	Keyword   sql.NullString
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WebhookID      uuid.UUID
+	PostID         uuid.NullUUID
+	Event          string
+	Payload        string
+	Status         string
+	Attempts       int32
+	NextAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
+	DeliveredAt    sql.NullTime
+}
+
+type WebsubSubscription struct {
+	FeedID         uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	State          string
+	LeaseExpiresAt sql.NullTime
+	LastError      sql.NullString
+	PendingSecret  sql.NullString
 }
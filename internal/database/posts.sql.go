@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createPost = `-- name: CreatePost :one
@@ -22,21 +23,41 @@ INSERT INTO posts (
   url,
   description,
   published_at,
-  feed_id
+  feed_id,
+  content,
+  authors,
+  categories,
+  comments_url,
+  thumbnail_url,
+  sanitized_description,
+  sanitized_content,
+  text_content,
+  summary,
+  cluster_id
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, content, authors, categories, comments_url, thumbnail_url, sanitized_description, sanitized_content, text_content, summary, article_content, cluster_id, seq
 `
 
 type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Title                string
+	Url                  string
+	Description          sql.NullString
+	PublishedAt          sql.NullTime
+	FeedID               uuid.UUID
+	Content              sql.NullString
+	Authors              []string
+	Categories           []string
+	CommentsUrl          sql.NullString
+	ThumbnailUrl         sql.NullString
+	SanitizedDescription sql.NullString
+	SanitizedContent     sql.NullString
+	TextContent          sql.NullString
+	Summary              sql.NullString
+	ClusterID            uuid.UUID
 }
 
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
@@ -49,6 +70,16 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.Content,
+		pq.Array(arg.Authors),
+		pq.Array(arg.Categories),
+		arg.CommentsUrl,
+		arg.ThumbnailUrl,
+		arg.SanitizedDescription,
+		arg.SanitizedContent,
+		arg.TextContent,
+		arg.Summary,
+		arg.ClusterID,
 	)
 	var i Post
 	err := row.Scan(
@@ -60,25 +91,234 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Content,
+		pq.Array(&i.Authors),
+		pq.Array(&i.Categories),
+		&i.CommentsUrl,
+		&i.ThumbnailUrl,
+		&i.SanitizedDescription,
+		&i.SanitizedContent,
+		&i.TextContent,
+		&i.Summary,
+		&i.ArticleContent,
+		&i.ClusterID,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const getClusterByURL = `-- name: GetClusterByURL :one
+SELECT cluster_id FROM posts
+WHERE url = $1 AND feed_id <> $2
+ORDER BY created_at
+LIMIT 1
+`
+
+type GetClusterByURLParams struct {
+	Url    string
+	FeedID uuid.UUID
+}
+
+func (q *Queries) GetClusterByURL(ctx context.Context, arg GetClusterByURLParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getClusterByURL, arg.Url, arg.FeedID)
+	var clusterID uuid.UUID
+	err := row.Scan(&clusterID)
+	return clusterID, err
+}
+
+const getFollowedPost = `-- name: GetFollowedPost :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.authors, posts.categories, posts.comments_url, posts.thumbnail_url, posts.sanitized_description, posts.sanitized_content, posts.text_content, posts.summary, posts.article_content, posts.cluster_id, posts.seq FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = $1 AND feed_follows.user_id = $2
+`
+
+type GetFollowedPostParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetFollowedPost(ctx context.Context, arg GetFollowedPostParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getFollowedPost, arg.ID, arg.UserID)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Content,
+		pq.Array(&i.Authors),
+		pq.Array(&i.Categories),
+		&i.CommentsUrl,
+		&i.ThumbnailUrl,
+		&i.SanitizedDescription,
+		&i.SanitizedContent,
+		&i.TextContent,
+		&i.Summary,
+		&i.ArticleContent,
+		&i.ClusterID,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const getPostByID = `-- name: GetPostByID :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, authors, categories, comments_url, thumbnail_url, sanitized_description, sanitized_content, text_content, summary, article_content, cluster_id, seq FROM posts WHERE id = $1
+`
+
+func (q *Queries) GetPostByID(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByID, id)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Content,
+		pq.Array(&i.Authors),
+		pq.Array(&i.Categories),
+		&i.CommentsUrl,
+		&i.ThumbnailUrl,
+		&i.SanitizedDescription,
+		&i.SanitizedContent,
+		&i.TextContent,
+		&i.Summary,
+		&i.ArticleContent,
+		&i.ClusterID,
+		&i.Seq,
 	)
 	return i, err
 }
 
 const getPostsByUser = `-- name: GetPostsByUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id FROM posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.authors, posts.categories, posts.comments_url, posts.thumbnail_url, posts.sanitized_description, posts.sanitized_content, posts.text_content, posts.summary, posts.article_content, posts.cluster_id, posts.seq FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
+AND NOT COALESCE(post_states.hidden, FALSE)
+AND ($2::text IS NULL OR $2 = ANY(posts.authors))
+AND ($3::text IS NULL OR $3 = ANY(posts.categories))
+AND ($4::text IS NULL OR EXISTS (
+  SELECT 1 FROM post_tags
+  JOIN tags ON tags.id = post_tags.tag_id
+  WHERE post_tags.post_id = posts.id
+  AND tags.user_id = $1
+  AND tags.name = $4
+))
+AND (NOT $5::bool OR posts.id = (
+  SELECT p2.id FROM posts p2
+  JOIN feed_follows ff2 ON ff2.feed_id = p2.feed_id
+  LEFT JOIN post_states ps2 ON ps2.post_id = p2.id AND ps2.user_id = ff2.user_id
+  WHERE ff2.user_id = $1 AND p2.cluster_id = posts.cluster_id
+  AND NOT COALESCE(ps2.hidden, FALSE)
+  AND ($2::text IS NULL OR $2 = ANY(p2.authors))
+  AND ($3::text IS NULL OR $3 = ANY(p2.categories))
+  AND ($4::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_tags
+    JOIN tags ON tags.id = post_tags.tag_id
+    WHERE post_tags.post_id = p2.id
+    AND tags.user_id = $1
+    AND tags.name = $4
+  ))
+  ORDER BY p2.created_at, p2.id
+  LIMIT 1
+))
 ORDER BY posts.published_at DESC
-LIMIT $2
+LIMIT $6
 `
 
 type GetPostsByUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+	UserID   uuid.UUID
+	Author   sql.NullString
+	Category sql.NullString
+	Tag      sql.NullString
+	Collapse bool
+	Limit    int32
 }
 
 func (q *Queries) GetPostsByUser(ctx context.Context, arg GetPostsByUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsByUser, arg.UserID, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, getPostsByUser,
+		arg.UserID,
+		arg.Author,
+		arg.Category,
+		arg.Tag,
+		arg.Collapse,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			pq.Array(&i.Authors),
+			pq.Array(&i.Categories),
+			&i.CommentsUrl,
+			&i.ThumbnailUrl,
+			&i.SanitizedDescription,
+			&i.SanitizedContent,
+			&i.TextContent,
+			&i.Summary,
+			&i.ArticleContent,
+			&i.ClusterID,
+			&i.Seq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsByUserSince = `-- name: GetPostsByUserSince :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.authors, posts.categories, posts.comments_url, posts.thumbnail_url, posts.sanitized_description, posts.sanitized_content, posts.text_content, posts.summary, posts.article_content, posts.cluster_id, posts.seq FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND NOT COALESCE(post_states.hidden, FALSE)
+AND (posts.created_at, posts.id) > ($2::timestamp, $3::uuid)
+ORDER BY posts.created_at, posts.id
+LIMIT $4
+`
+
+type GetPostsByUserSinceParams struct {
+	UserID         uuid.UUID
+	AfterCreatedAt time.Time
+	AfterID        uuid.UUID
+	Limit          int32
+}
+
+func (q *Queries) GetPostsByUserSince(ctx context.Context, arg GetPostsByUserSinceParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsByUserSince,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +335,18 @@ func (q *Queries) GetPostsByUser(ctx context.Context, arg GetPostsByUserParams)
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Content,
+			pq.Array(&i.Authors),
+			pq.Array(&i.Categories),
+			&i.CommentsUrl,
+			&i.ThumbnailUrl,
+			&i.SanitizedDescription,
+			&i.SanitizedContent,
+			&i.TextContent,
+			&i.Summary,
+			&i.ArticleContent,
+			&i.ClusterID,
+			&i.Seq,
 		); err != nil {
 			return nil, err
 		}
@@ -108,3 +360,102 @@ func (q *Queries) GetPostsByUser(ctx context.Context, arg GetPostsByUserParams)
 	}
 	return items, nil
 }
+
+const getRecentPostTitles = `-- name: GetRecentPostTitles :many
+SELECT id, title, cluster_id FROM posts
+WHERE feed_id <> $1 AND created_at > $2
+ORDER BY created_at DESC
+LIMIT 2000
+`
+
+type GetRecentPostTitlesParams struct {
+	FeedID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type GetRecentPostTitlesRow struct {
+	ID        uuid.UUID
+	Title     string
+	ClusterID uuid.UUID
+}
+
+func (q *Queries) GetRecentPostTitles(ctx context.Context, arg GetRecentPostTitlesParams) ([]GetRecentPostTitlesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPostTitles, arg.FeedID, arg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentPostTitlesRow
+	for rows.Next() {
+		var i GetRecentPostTitlesRow
+		if err := rows.Scan(&i.ID, &i.Title, &i.ClusterID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePosts = `-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = $1, updated_at = NOW()
+WHERE feed_id = $2
+AND url NOT IN (
+  SELECT url FROM posts WHERE feed_id = $1
+)
+`
+
+type MovePostsParams struct {
+	NewFeedID uuid.UUID
+	OldFeedID uuid.UUID
+}
+
+func (q *Queries) MovePosts(ctx context.Context, arg MovePostsParams) error {
+	_, err := q.db.ExecContext(ctx, movePosts, arg.NewFeedID, arg.OldFeedID)
+	return err
+}
+
+const setPostCluster = `-- name: SetPostCluster :exec
+UPDATE posts
+SET cluster_id = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetPostClusterParams struct {
+	ID        uuid.UUID
+	ClusterID uuid.UUID
+}
+
+func (q *Queries) SetPostCluster(ctx context.Context, arg SetPostClusterParams) error {
+	_, err := q.db.ExecContext(ctx, setPostCluster, arg.ID, arg.ClusterID)
+	return err
+}
+
+const updatePostArticle = `-- name: UpdatePostArticle :exec
+UPDATE posts
+SET article_content = $2, text_content = $3, summary = $4, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdatePostArticleParams struct {
+	ID             uuid.UUID
+	ArticleContent sql.NullString
+	TextContent    sql.NullString
+	Summary        sql.NullString
+}
+
+func (q *Queries) UpdatePostArticle(ctx context.Context, arg UpdatePostArticleParams) error {
+	_, err := q.db.ExecContext(ctx, updatePostArticle,
+		arg.ID,
+		arg.ArticleContent,
+		arg.TextContent,
+		arg.Summary,
+	)
+	return err
+}
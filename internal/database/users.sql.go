@@ -7,15 +7,16 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name, api_key)
-VALUES ($1, $2, $3, $4, encode(sha256(random()::text::bytea), 'hex'))
-RETURNING id, created_at, updated_at, name, api_key
+INSERT INTO users (id, created_at, updated_at, name, api_key, feed_token)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at
 `
 
 type CreateUserParams struct {
@@ -23,6 +24,8 @@ type CreateUserParams struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Name      string
+	ApiKey    string
+	FeedToken string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -31,6 +34,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.Name,
+		arg.ApiKey,
+		arg.FeedToken,
 	)
 	var i User
 	err := row.Scan(
@@ -39,12 +44,17 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Name,
 		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
 	)
 	return i, err
 }
 
 const getUserByAPIKey = `-- name: GetUserByAPIKey :one
-SELECT id, created_at, updated_at, name, api_key FROM users WHERE api_key = $1
+SELECT id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at FROM users WHERE api_key = $1
 `
 
 func (q *Queries) GetUserByAPIKey(ctx context.Context, apiKey string) (User, error) {
@@ -56,6 +66,206 @@ func (q *Queries) GetUserByAPIKey(ctx context.Context, apiKey string) (User, err
 		&i.UpdatedAt,
 		&i.Name,
 		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
+	)
+	return i, err
+}
+
+const getUserByClientLoginName = `-- name: GetUserByClientLoginName :one
+SELECT id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at FROM users
+WHERE name = $1 AND client_password_hash IS NOT NULL
+`
+
+func (q *Queries) GetUserByClientLoginName(ctx context.Context, name string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByClientLoginName, name)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
+	)
+	return i, err
+}
+
+const getUserByFeedToken = `-- name: GetUserByFeedToken :one
+SELECT id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at FROM users WHERE feed_token = $1
+`
+
+func (q *Queries) GetUserByFeedToken(ctx context.Context, feedToken string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByFeedToken, feedToken)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
+	)
+	return i, err
+}
+
+const getUserByFeverAPIKey = `-- name: GetUserByFeverAPIKey :one
+SELECT id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at FROM users WHERE fever_api_key = $1
+`
+
+func (q *Queries) GetUserByFeverAPIKey(ctx context.Context, feverApiKey sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByFeverAPIKey, feverApiKey)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
+	)
+	return i, err
+}
+
+const getUserByGReaderAuthToken = `-- name: GetUserByGReaderAuthToken :one
+SELECT id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at FROM users
+WHERE greader_auth_token = $1 AND greader_auth_expires_at > $2
+`
+
+type GetUserByGReaderAuthTokenParams struct {
+	GreaderAuthToken     sql.NullString
+	GreaderAuthExpiresAt sql.NullTime
+}
+
+func (q *Queries) GetUserByGReaderAuthToken(ctx context.Context, arg GetUserByGReaderAuthTokenParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByGReaderAuthToken, arg.GreaderAuthToken, arg.GreaderAuthExpiresAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
+	)
+	return i, err
+}
+
+const rotateUserFeedToken = `-- name: RotateUserFeedToken :one
+UPDATE users
+SET feed_token = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at
+`
+
+type RotateUserFeedTokenParams struct {
+	ID        uuid.UUID
+	FeedToken string
+}
+
+func (q *Queries) RotateUserFeedToken(ctx context.Context, arg RotateUserFeedTokenParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, rotateUserFeedToken, arg.ID, arg.FeedToken)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
+	)
+	return i, err
+}
+
+const setUserClientPassword = `-- name: SetUserClientPassword :exec
+UPDATE users
+SET client_password_hash = $2, fever_api_key = $3, greader_auth_token = NULL, greader_auth_expires_at = NULL, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUserClientPasswordParams struct {
+	ID                 uuid.UUID
+	ClientPasswordHash sql.NullString
+	FeverApiKey        sql.NullString
+}
+
+func (q *Queries) SetUserClientPassword(ctx context.Context, arg SetUserClientPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserClientPassword, arg.ID, arg.ClientPasswordHash, arg.FeverApiKey)
+	return err
+}
+
+const setUserGReaderAuthToken = `-- name: SetUserGReaderAuthToken :one
+UPDATE users
+SET greader_auth_token = $2, greader_auth_expires_at = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, api_key, feed_token, client_password_hash, fever_api_key, greader_auth_token, greader_auth_expires_at
+`
+
+type SetUserGReaderAuthTokenParams struct {
+	ID                   uuid.UUID
+	GreaderAuthToken     sql.NullString
+	GreaderAuthExpiresAt sql.NullTime
+}
+
+func (q *Queries) SetUserGReaderAuthToken(ctx context.Context, arg SetUserGReaderAuthTokenParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserGReaderAuthToken, arg.ID, arg.GreaderAuthToken, arg.GreaderAuthExpiresAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.ClientPasswordHash,
+		&i.FeverApiKey,
+		&i.GreaderAuthToken,
+		&i.GreaderAuthExpiresAt,
 	)
 	return i, err
 }
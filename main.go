@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -16,7 +17,22 @@ import (
 )
 
 type apiConfig struct {
-	DB *database.Queries
+	DB            *database.Queries
+	Conn          *sql.DB
+	MaxFeedBytes  int64
+	FeedTransport http.RoundTripper
+	// WebhookTransport delivers webhooks. Unlike FeedTransport it ignores
+	// FEED_ALLOWED_NETWORKS, since webhook URLs come from any user and the
+	// allowlist is only meant for feeds we host ourselves.
+	WebhookTransport http.RoundTripper
+	Events           *eventBus
+	// PublicBaseURL is where this server can be reached from outside, used
+	// for WebSub callbacks and digest confirmation links. WebSub is disabled
+	// and digests can't be set up when it's empty.
+	PublicBaseURL string
+	// Mailer sends digests and notifications, or is nil if email isn't
+	// configured.
+	Mailer mailer
 }
 
 func main() {
@@ -24,13 +40,43 @@ func main() {
 	port := os.Getenv("PORT")
 	dbURL := os.Getenv("DB_CONN")
 
+	maxFeedBytes := int64(defaultMaxFeedBytes)
+	if v := os.Getenv("MAX_FEED_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid MAX_FEED_BYTES %q", v)
+		}
+		maxFeedBytes = n
+	}
+
+	allowedNetworks, err := parseAllowedNetworks(os.Getenv("FEED_ALLOWED_NETWORKS"))
+	if err != nil {
+		log.Fatalf("Invalid FEED_ALLOWED_NETWORKS: %v", err)
+	}
+
+	smtpServer, err := smtpConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal(err)
 	}
 	dbQueries := database.New(db)
 	apiConfig := &apiConfig{
-		DB: dbQueries,
+		DB:           dbQueries,
+		Conn:         db,
+		MaxFeedBytes: maxFeedBytes,
+		FeedTransport: newFeedTransport(&addressGuard{
+			allowed: allowedNetworks,
+		}),
+		WebhookTransport: newFeedTransport(&addressGuard{}),
+		Events:           newEventBus(),
+		PublicBaseURL:    os.Getenv("PUBLIC_BASE_URL"),
+	}
+	if smtpServer != nil {
+		apiConfig.Mailer = smtpServer
 	}
 
 	appRouter := chi.NewRouter()
@@ -48,6 +94,7 @@ func main() {
 		MaxAge:           300,
 	})
 	appRouter.Use(corsMiddleware)
+	appRouter.Use(newResponseCompressor())
 
 	v1Router := chi.NewRouter()
 	v1Router.Get("/readiness", readinessHandler)
@@ -58,16 +105,88 @@ func main() {
 
 	v1Router.Post("/feeds", apiConfig.middlewareAuth(apiConfig.createFeedHandler))
 	v1Router.Get("/feeds", apiConfig.getAllFeeds)
+	v1Router.Put("/feeds/{feedID}", apiConfig.middlewareAuth(apiConfig.updateFeedHandler))
 
 	v1Router.Post("/feed_follows", apiConfig.middlewareAuth(apiConfig.createFeedFollowHandler))
 	v1Router.Get("/feed_follows", apiConfig.middlewareAuth(apiConfig.getFeedFollowsHandler))
 	v1Router.Delete("/feed_follows/{feedFollowID}", apiConfig.middlewareAuth(apiConfig.deleteFeedFollowHandler))
 
+	v1Router.Get("/posts", apiConfig.middlewareAuth(apiConfig.getPostsHandler))
+	v1Router.Get("/posts/stream", apiConfig.middlewareAuth(apiConfig.streamPostsHandler))
+	v1Router.Put("/posts/{postID}/state", apiConfig.middlewareAuth(apiConfig.updatePostStateHandler))
+	v1Router.Get("/post_states", apiConfig.middlewareAuth(apiConfig.getPostStatesHandler))
+	v1Router.Get("/ws", apiConfig.middlewareAuth(apiConfig.websocketHandler))
+
+	v1Router.Post("/users/feed_token", apiConfig.middlewareAuth(apiConfig.rotateFeedTokenHandler))
+	v1Router.Put("/users/client_password", apiConfig.middlewareAuth(apiConfig.setClientPasswordHandler))
+	v1Router.Get("/timeline/{feedToken}/atom", apiConfig.getTimelineAtomHandler)
+	v1Router.Get("/timeline/{feedToken}/rss", apiConfig.getTimelineRSSHandler)
+
+	v1Router.Post("/collections", apiConfig.middlewareAuth(apiConfig.createCollectionHandler))
+	v1Router.Get("/collections", apiConfig.middlewareAuth(apiConfig.getCollectionsHandler))
+	v1Router.Delete("/collections/{collectionID}", apiConfig.middlewareAuth(apiConfig.deleteCollectionHandler))
+	v1Router.Post("/collections/{collectionID}/posts", apiConfig.middlewareAuth(apiConfig.addCollectionPostHandler))
+	v1Router.Delete("/collections/{collectionID}/posts/{postID}", apiConfig.middlewareAuth(apiConfig.removeCollectionPostHandler))
+	v1Router.Get("/shared/{slug}/rss", apiConfig.getSharedCollectionRSSHandler)
+	v1Router.Get("/shared/{slug}/atom", apiConfig.getSharedCollectionAtomHandler)
+	v1Router.Get("/shared/{slug}/json", apiConfig.getSharedCollectionJSONHandler)
+
+	v1Router.Post("/webhooks", apiConfig.middlewareAuth(apiConfig.createWebhookHandler))
+	v1Router.Get("/webhooks", apiConfig.middlewareAuth(apiConfig.getWebhooksHandler))
+	v1Router.Delete("/webhooks/{webhookID}", apiConfig.middlewareAuth(apiConfig.deleteWebhookHandler))
+	v1Router.Get("/webhooks/{webhookID}/deliveries", apiConfig.middlewareAuth(apiConfig.getWebhookDeliveriesHandler))
+	v1Router.Post("/webhooks/{webhookID}/test", apiConfig.middlewareAuth(apiConfig.testWebhookHandler))
+
+	v1Router.Post("/tags", apiConfig.middlewareAuth(apiConfig.createTagHandler))
+	v1Router.Get("/tags", apiConfig.middlewareAuth(apiConfig.getTagsHandler))
+	v1Router.Put("/tags/{tagID}", apiConfig.middlewareAuth(apiConfig.renameTagHandler))
+	v1Router.Delete("/tags/{tagID}", apiConfig.middlewareAuth(apiConfig.deleteTagHandler))
+	v1Router.Post("/posts/{postID}/tags", apiConfig.middlewareAuth(apiConfig.addPostTagHandler))
+	v1Router.Delete("/posts/{postID}/tags/{tagID}", apiConfig.middlewareAuth(apiConfig.removePostTagHandler))
+
+	v1Router.Post("/filter_rules", apiConfig.middlewareAuth(apiConfig.createFilterRuleHandler))
+	v1Router.Get("/filter_rules", apiConfig.middlewareAuth(apiConfig.getFilterRulesHandler))
+	v1Router.Delete("/filter_rules/{ruleID}", apiConfig.middlewareAuth(apiConfig.deleteFilterRuleHandler))
+	v1Router.Post("/filter_rules/{ruleID}/apply", apiConfig.middlewareAuth(apiConfig.applyFilterRuleHandler))
+
+	v1Router.Get("/digest", apiConfig.middlewareAuth(apiConfig.getDigestSettingsHandler))
+	v1Router.Put("/digest", apiConfig.middlewareAuth(apiConfig.updateDigestSettingsHandler))
+	v1Router.Delete("/digest", apiConfig.middlewareAuth(apiConfig.deleteDigestSettingsHandler))
+	v1Router.Post("/digest/send", apiConfig.middlewareAuth(apiConfig.sendDigestHandler))
+	v1Router.Get("/digest/verify", apiConfig.verifyDigestEmailHandler)
+
+	v1Router.Get("/websub/{feedID}", apiConfig.websubVerifyHandler)
+	v1Router.Post("/websub/{feedID}", apiConfig.websubPushHandler)
+
 	appRouter.Mount("/v1", v1Router)
 
+	// Third-party reader APIs live outside /v1 at the paths their clients
+	// expect.
+	appRouter.HandleFunc("/fever", apiConfig.feverHandler)
+	appRouter.HandleFunc("/fever/", apiConfig.feverHandler)
+	appRouter.HandleFunc("/accounts/ClientLogin", apiConfig.greaderClientLoginHandler)
+	appRouter.Mount("/reader/api/0", apiConfig.greaderRouter())
+
 	const scraperConcurrency = 10
 	const scraperInterval = time.Minute
-	go startScraping(dbQueries, scraperConcurrency, scraperInterval)
+	go apiConfig.startScraping(scraperConcurrency, scraperInterval)
+
+	const articleConcurrency = 5
+	const articleInterval = 10 * time.Second
+	go apiConfig.startArticleExtraction(articleConcurrency, articleInterval)
+
+	const webhookInterval = 10 * time.Second
+	go apiConfig.startWebhookDelivery(webhookInterval)
+
+	if apiConfig.Mailer != nil {
+		const digestInterval = 5 * time.Minute
+		go apiConfig.startDigests(digestInterval)
+	}
+
+	if apiConfig.PublicBaseURL != "" {
+		const websubRenewalInterval = time.Hour
+		go apiConfig.startWebSubRenewal(websubRenewalInterval)
+	}
 
 	fmt.Printf("Starting server on http://localhost%s...\n", server.Addr)
 	log.Fatal(server.ListenAndServe())
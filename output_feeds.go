@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// outputFeed is a feed we publish, independent of the format it's rendered
+// in.
+type outputFeed struct {
+	ID          string
+	Title       string
+	Description string
+	// SelfURL is where this rendering of the feed is served from.
+	SelfURL string
+	// SiteURL is the human-readable page the feed belongs to, if any.
+	SiteURL string
+	Updated time.Time
+	Items   []outputItem
+}
+
+type outputItem struct {
+	ID         string
+	Title      string
+	Link       string
+	Summary    string
+	Content    string
+	Published  time.Time
+	Updated    time.Time
+	Authors    []string
+	Categories []string
+}
+
+// newOutputFeed builds an output feed from posts, using their sanitized HTML
+// for content.
+func newOutputFeed(id, title, description, selfURL, siteURL string, posts []database.Post) outputFeed {
+	feed := outputFeed{
+		ID:          id,
+		Title:       title,
+		Description: description,
+		SelfURL:     selfURL,
+		SiteURL:     siteURL,
+		Items:       make([]outputItem, 0, len(posts)),
+	}
+	for _, post := range posts {
+		res := databasePostToPost(post, nil, postFormatHTML)
+		published := post.CreatedAt
+		if post.PublishedAt.Valid {
+			published = post.PublishedAt.Time
+		}
+		item := outputItem{
+			ID:         "urn:uuid:" + post.ID.String(),
+			Title:      post.Title,
+			Link:       post.Url,
+			Content:    deref(res.Body),
+			Published:  published,
+			Updated:    post.UpdatedAt,
+			Authors:    post.Authors,
+			Categories: post.Categories,
+		}
+		if post.Summary.Valid {
+			item.Summary = post.Summary.String
+		}
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	if feed.Updated.IsZero() {
+		feed.Updated = time.Unix(0, 0).UTC()
+	}
+	return feed
+}
+
+type atomFeedXML struct {
+	XMLName  xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string         `xml:"id"`
+	Title    string         `xml:"title"`
+	Subtitle string         `xml:"subtitle,omitempty"`
+	Updated  string         `xml:"updated"`
+	Links    []atomLinkXML  `xml:"link"`
+	Entries  []atomEntryXML `xml:"entry"`
+}
+
+type atomLinkXML struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntryXML struct {
+	ID         string            `xml:"id"`
+	Title      string            `xml:"title"`
+	Links      []atomLinkXML     `xml:"link"`
+	Published  string            `xml:"published"`
+	Updated    string            `xml:"updated"`
+	Authors    []atomAuthorXML   `xml:"author"`
+	Categories []atomCategoryXML `xml:"category"`
+	Summary    *atomTextXML      `xml:"summary"`
+	Content    *atomTextXML      `xml:"content"`
+}
+
+type atomAuthorXML struct {
+	Name string `xml:"name"`
+}
+
+type atomCategoryXML struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomTextXML struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+func renderAtom(feed outputFeed) ([]byte, error) {
+	doc := atomFeedXML{
+		ID:       feed.ID,
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		Updated:  feed.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLinkXML{{
+			Href: feed.SelfURL,
+			Rel:  "self",
+			Type: "application/atom+xml",
+		}},
+	}
+	if feed.SiteURL != "" {
+		doc.Links = append(doc.Links, atomLinkXML{Href: feed.SiteURL, Rel: "alternate"})
+	}
+	for _, item := range feed.Items {
+		entry := atomEntryXML{
+			ID:        item.ID,
+			Title:     item.Title,
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+		}
+		if item.Link != "" {
+			entry.Links = []atomLinkXML{{Href: item.Link, Rel: "alternate"}}
+		}
+		for _, author := range item.Authors {
+			entry.Authors = append(entry.Authors, atomAuthorXML{Name: author})
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, atomCategoryXML{Term: category})
+		}
+		if item.Summary != "" {
+			entry.Summary = &atomTextXML{Type: "text", Text: item.Summary}
+		}
+		if item.Content != "" {
+			entry.Content = &atomTextXML{Type: "html", Text: item.Content}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return marshalXMLDocument(doc)
+}
+
+type rssFeedXML struct {
+	XMLName xml.Name      `xml:"rss"`
+	Version string        `xml:"version,attr"`
+	AtomNS  string        `xml:"xmlns:atom,attr"`
+	DCNS    string        `xml:"xmlns:dc,attr,omitempty"`
+	Channel rssChannelXML `xml:"channel"`
+}
+
+type rssChannelXML struct {
+	Title         string         `xml:"title"`
+	Link          string         `xml:"link"`
+	Description   string         `xml:"description"`
+	LastBuildDate string         `xml:"lastBuildDate"`
+	AtomLink      rssAtomLinkXML `xml:"atom:link"`
+	Items         []rssItemXML   `xml:"item"`
+}
+
+type rssAtomLinkXML struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItemXML struct {
+	Title       string     `xml:"title"`
+	Link        string     `xml:"link,omitempty"`
+	GUID        rssGUIDXML `xml:"guid"`
+	PubDate     string     `xml:"pubDate"`
+	Authors     []string   `xml:"dc:creator"`
+	Categories  []string   `xml:"category"`
+	Description string     `xml:"description,omitempty"`
+}
+
+type rssGUIDXML struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func renderRSS(feed outputFeed) ([]byte, error) {
+	link := feed.SiteURL
+	if link == "" {
+		link = feed.SelfURL
+	}
+	doc := rssFeedXML{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannelXML{
+			Title:         feed.Title,
+			Link:          link,
+			Description:   feed.Description,
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+			AtomLink: rssAtomLinkXML{
+				Href: feed.SelfURL,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			},
+		},
+	}
+	for _, item := range feed.Items {
+		description := item.Content
+		if description == "" {
+			description = item.Summary
+		}
+		doc.Channel.Items = append(doc.Channel.Items, rssItemXML{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUIDXML{Value: item.ID},
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+			Authors:     item.Authors,
+			Categories:  item.Categories,
+			Description: description,
+		})
+		if len(item.Authors) > 0 {
+			doc.DCNS = "http://purl.org/dc/elements/1.1/"
+		}
+	}
+	return marshalXMLDocument(doc)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// renderJSONFeed renders feed as JSON Feed 1.1 (https://jsonfeed.org).
+func renderJSONFeed(feed outputFeed) ([]byte, error) {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.SiteURL,
+		FeedURL:     feed.SelfURL,
+		Description: feed.Description,
+		Items:       make([]jsonFeedItem, 0, len(feed.Items)),
+	}
+	for _, item := range feed.Items {
+		entry := jsonFeedItem{
+			ID:            item.ID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			Summary:       item.Summary,
+			DatePublished: item.Published.UTC().Format(time.RFC3339),
+			DateModified:  item.Updated.UTC().Format(time.RFC3339),
+			Tags:          item.Categories,
+		}
+		for _, author := range item.Authors {
+			entry.Authors = append(entry.Authors, jsonFeedAuthor{Name: author})
+		}
+		doc.Items = append(doc.Items, entry)
+	}
+	return json.Marshal(doc)
+}
+
+func marshalXMLDocument(doc interface{}) ([]byte, error) {
+	dat, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), dat...), nil
+}
+
+// serveFeedDocument writes a rendered feed with validators so readers that
+// poll it can get a 304 instead of the whole document.
+func serveFeedDocument(w http.ResponseWriter, r *http.Request, contentType, cacheControl string, body []byte, lastModified time.Time) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	lastModified = lastModified.UTC().Truncate(time.Second)
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+const (
+	// clusterWindow is how far back we look for other copies of a story.
+	clusterWindow = 48 * time.Hour
+	// Titles need at least this many words and this much overlap before we
+	// treat two posts as the same story.
+	minClusterTitleWords   = 4
+	minClusterTitleJaccard = 0.75
+)
+
+// assignCluster puts a freshly created post into the cluster of a matching
+// post from another feed: first one with the same canonical URL, otherwise
+// a recent one with a near-identical title. Posts without a match stay in
+// the single-post cluster they were created with.
+func (cfg *apiConfig) assignCluster(ctx context.Context, post database.Post) error {
+	if post.Url != "" {
+		clusterID, err := cfg.DB.GetClusterByURL(ctx, database.GetClusterByURLParams{
+			Url:    post.Url,
+			FeedID: post.FeedID,
+		})
+		if err == nil {
+			return cfg.setPostCluster(ctx, post, clusterID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+
+	words := titleWords(post.Title)
+	if len(words) < minClusterTitleWords {
+		return nil
+	}
+	recent, err := cfg.DB.GetRecentPostTitles(ctx, database.GetRecentPostTitlesParams{
+		FeedID:    post.FeedID,
+		CreatedAt: time.Now().UTC().Add(-clusterWindow),
+	})
+	if err != nil {
+		return err
+	}
+	for _, candidate := range recent {
+		if titleSimilarity(words, titleWords(candidate.Title)) >= minClusterTitleJaccard {
+			return cfg.setPostCluster(ctx, post, candidate.ClusterID)
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) setPostCluster(ctx context.Context, post database.Post, clusterID uuid.UUID) error {
+	if post.ClusterID == clusterID {
+		return nil
+	}
+	return cfg.DB.SetPostCluster(ctx, database.SetPostClusterParams{
+		ID:        post.ID,
+		ClusterID: clusterID,
+	})
+}
+
+// titleWords returns the set of lowercased words in a title, ignoring
+// punctuation and very short words.
+func titleWords(title string) map[string]bool {
+	words := map[string]bool{}
+	fields := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, field := range fields {
+		if len([]rune(field)) > 2 {
+			words[field] = true
+		}
+	}
+	return words
+}
+
+// titleSimilarity is the Jaccard index of two word sets.
+func titleSimilarity(a, b map[string]bool) float64 {
+	if len(a) < minClusterTitleWords || len(b) < minClusterTitleWords {
+		return 0
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// eventBufferSize is how many events a subscriber can fall behind by before
+// it's dropped.
+const eventBufferSize = 64
+
+// event is something that happened which open streams may want to hear
+// about. Exactly one field is set.
+type event struct {
+	// Post is a newly ingested post.
+	Post *database.Post
+	// HiddenFor is the users whose filter rules hid Post as it was
+	// ingested.
+	HiddenFor map[uuid.UUID]bool
+	// State is a user's changed read or starred state for a post.
+	State *database.PostState
+	// Notification is a post one of the user's notify rules matched.
+	Notification *notification
+}
+
+type notification struct {
+	UserID uuid.UUID
+	RuleID uuid.UUID
+	Post   database.Post
+}
+
+// eventBus fans events out to in-process subscribers, such as open event
+// streams and WebSocket connections.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: map[chan event]struct{}{},
+	}
+}
+
+// subscribe returns a channel of events and a function that stops the
+// subscription. The channel is closed if the subscriber falls too far
+// behind, so it can reconnect and catch up from the database instead of
+// silently missing events.
+func (b *eventBus) subscribe() (<-chan event, func()) {
+	ch := make(chan event, eventBufferSize)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends e to every subscriber without blocking the caller.
+func (b *eventBus) publish(e event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *eventBus) publishPost(post database.Post, hiddenFor map[uuid.UUID]bool) {
+	b.publish(event{Post: &post, HiddenFor: hiddenFor})
+}
+
+func (b *eventBus) publishState(state database.PostState) {
+	b.publish(event{State: &state})
+}
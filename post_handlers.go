@@ -0,0 +1,243 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+const (
+	defaultPostsLimit = 20
+	maxPostsLimit     = 100
+)
+
+// Post body formats accepted by the posts API. html, the default, returns
+// sanitized HTML; full returns the HTML exactly as the feed sent it.
+const (
+	postFormatFull    = "full"
+	postFormatHTML    = "html"
+	postFormatText    = "text"
+	postFormatSummary = "summary"
+)
+
+type Post struct {
+	ID             uuid.UUID   `json:"id"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	Title          string      `json:"title"`
+	Url            string      `json:"url"`
+	Description    *string     `json:"description"`
+	PublishedAt    *time.Time  `json:"published_at"`
+	FeedID         uuid.UUID   `json:"feed_id"`
+	Content        *string     `json:"content"`
+	Authors        []string    `json:"authors"`
+	Categories     []string    `json:"categories"`
+	CommentsUrl    *string     `json:"comments_url"`
+	ThumbnailUrl   *string     `json:"thumbnail_url"`
+	Enclosures     []Enclosure `json:"enclosures"`
+	ArticleContent *string     `json:"article_content"`
+	ClusterID      uuid.UUID   `json:"cluster_id"`
+	Format         string      `json:"format"`
+	Body           *string     `json:"body"`
+}
+
+type Enclosure struct {
+	Url             string  `json:"url"`
+	Length          *int64  `json:"length"`
+	MimeType        *string `json:"mime_type"`
+	DurationSeconds *int32  `json:"duration_seconds"`
+	ImageUrl        *string `json:"image_url"`
+	Season          *int32  `json:"season"`
+	Episode         *int32  `json:"episode"`
+}
+
+func (cfg *apiConfig) getPostsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type PostsResponse struct {
+		Posts []Post `json:"posts"`
+	}
+
+	limit := defaultPostsLimit
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		n, err := strconv.Atoi(limitString)
+		if err != nil || n <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(n, maxPostsLimit)
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = postFormatHTML
+	case postFormatFull, postFormatHTML, postFormatText, postFormatSummary:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid format")
+		return
+	}
+
+	posts, err := cfg.DB.GetPostsByUser(r.Context(), database.GetPostsByUserParams{
+		UserID:   user.ID,
+		Author:   toNullString(r.URL.Query().Get("author")),
+		Category: toNullString(r.URL.Query().Get("category")),
+		Tag:      toNullString(r.URL.Query().Get("tag")),
+		Collapse: r.URL.Query().Get("collapse") == "true",
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get posts")
+		return
+	}
+
+	res, err := cfg.postsToResponse(r, posts, format)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get post enclosures")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, PostsResponse{
+		Posts: res,
+	})
+}
+
+// postsToResponse converts posts for the API, attaching their enclosures and
+// rendering their body in the given format.
+func (cfg *apiConfig) postsToResponse(r *http.Request, posts []database.Post, format string) ([]Post, error) {
+	postIDs := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID)
+	}
+	enclosures, err := cfg.DB.GetEnclosuresForPosts(r.Context(), postIDs)
+	if err != nil {
+		return nil, err
+	}
+	enclosuresByPost := map[uuid.UUID][]Enclosure{}
+	for _, enclosure := range enclosures {
+		enclosuresByPost[enclosure.PostID] = append(enclosuresByPost[enclosure.PostID], Enclosure{
+			Url:             enclosure.Url,
+			Length:          nullInt64Ptr(enclosure.Length),
+			MimeType:        nullStringPtr(enclosure.MimeType),
+			DurationSeconds: nullInt32Ptr(enclosure.DurationSeconds),
+			ImageUrl:        nullStringPtr(enclosure.ImageUrl),
+			Season:          nullInt32Ptr(enclosure.Season),
+			Episode:         nullInt32Ptr(enclosure.Episode),
+		})
+	}
+
+	res := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		postEnclosures := enclosuresByPost[post.ID]
+		if postEnclosures == nil {
+			postEnclosures = []Enclosure{}
+		}
+		res = append(res, databasePostToPost(post, postEnclosures, format))
+	}
+	return res, nil
+}
+
+func databasePostToPost(post database.Post, enclosures []Enclosure, format string) Post {
+	res := Post{
+		ID:           post.ID,
+		CreatedAt:    post.CreatedAt,
+		UpdatedAt:    post.UpdatedAt,
+		Title:        post.Title,
+		Url:          post.Url,
+		PublishedAt:  nullTimePtr(post.PublishedAt),
+		FeedID:       post.FeedID,
+		Authors:      post.Authors,
+		Categories:   post.Categories,
+		CommentsUrl:  nullStringPtr(post.CommentsUrl),
+		ThumbnailUrl: nullStringPtr(post.ThumbnailUrl),
+		Enclosures:   enclosures,
+		ClusterID:    post.ClusterID,
+		Format:       format,
+	}
+
+	sanitizedDescription := sanitizedPostHTML(post.SanitizedDescription, post.Description, post.Url)
+	sanitizedContent := sanitizedPostHTML(post.SanitizedContent, post.Content, post.Url)
+	switch format {
+	case postFormatFull:
+		res.Description = nullStringPtr(post.Description)
+		res.Content = nullStringPtr(post.Content)
+		res.Body = firstNonNil(res.Content, res.Description)
+	case postFormatHTML:
+		res.Description = sanitizedDescription
+		res.Content = sanitizedContent
+		res.ArticleContent = nullStringPtr(post.ArticleContent)
+		res.Body = firstNonNil(res.ArticleContent, res.Content, res.Description)
+	case postFormatText, postFormatSummary:
+		text := post.TextContent.String
+		if !post.TextContent.Valid {
+			text = htmlToText(deref(firstNonNil(sanitizedContent, sanitizedDescription)))
+		}
+		if format == postFormatSummary {
+			if post.Summary.Valid {
+				text = post.Summary.String
+			} else {
+				text = summarize(text)
+			}
+		}
+		res.Body = &text
+	}
+	return res
+}
+
+// firstNonNil returns the first of values that is set and not blank.
+func firstNonNil(values ...*string) *string {
+	for _, v := range values {
+		if v != nil && strings.TrimSpace(*v) != "" {
+			return v
+		}
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// sanitizedPostHTML returns the stored sanitized form of a post field, or
+// sanitizes the raw field for posts stored before sanitization existed.
+func sanitizedPostHTML(sanitized, raw sql.NullString, baseURL string) *string {
+	if sanitized.Valid || !raw.Valid {
+		return nullStringPtr(sanitized)
+	}
+	s := sanitizeHTML(raw.String, baseURL)
+	return &s
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullInt32Ptr(n sql.NullInt32) *int32 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int32
+}
+
+func nullInt64Ptr(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// postStatesLimit caps how many state changes one sync request returns.
+const postStatesLimit = 1000
+
+var errPostNotFound = errors.New("post not found")
+
+type PostState struct {
+	PostID    uuid.UUID `json:"post_id"`
+	Read      bool      `json:"read"`
+	Starred   bool      `json:"starred"`
+	Hidden    bool      `json:"hidden"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func databasePostStateToPostState(state database.PostState) PostState {
+	return PostState{
+		PostID:    state.PostID,
+		Read:      state.Read,
+		Starred:   state.Starred,
+		Hidden:    state.Hidden,
+		UpdatedAt: state.UpdatedAt,
+	}
+}
+
+// postStateChange is a change to a user's view of a post. Nil fields are
+// left as they are.
+type postStateChange struct {
+	Read    *bool
+	Starred *bool
+	Hidden  *bool
+}
+
+// setPostState applies change to the user's view of a post and tells the
+// user's other connections about it. The change is applied in a single
+// statement, so concurrent changes to different fields from different
+// devices don't overwrite each other. Posts outside the user's followed
+// feeds are reported as errPostNotFound.
+func (cfg *apiConfig) setPostState(ctx context.Context, userID, postID uuid.UUID, change postStateChange) (database.PostState, error) {
+	state, err := cfg.DB.UpsertPostState(ctx, database.UpsertPostStateParams{
+		Read:      nullBool(change.Read),
+		Starred:   nullBool(change.Starred),
+		Hidden:    nullBool(change.Hidden),
+		UpdatedAt: time.Now().UTC(),
+		PostID:    postID,
+		UserID:    userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.PostState{}, errPostNotFound
+	}
+	if err != nil {
+		return database.PostState{}, err
+	}
+	cfg.Events.publishState(state)
+	return state, nil
+}
+
+func nullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
+
+func (cfg *apiConfig) updatePostStateHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Read    *bool `json:"read"`
+		Starred *bool `json:"starred"`
+		Hidden  *bool `json:"hidden"`
+	}
+
+	postID, err := uuid.Parse(chi.URLParam(r, "postID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	state, err := cfg.setPostState(r.Context(), user.ID, postID, postStateChange{
+		Read:    params.Read,
+		Starred: params.Starred,
+		Hidden:  params.Hidden,
+	})
+	if errors.Is(err, errPostNotFound) {
+		respondWithError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update post state")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databasePostStateToPostState(state))
+}
+
+// getPostStatesHandler returns the user's read and starred changes since
+// an RFC 3339 timestamp, oldest first, so a client can catch up after
+// being offline.
+func (cfg *apiConfig) getPostStatesHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	since := time.Time{}
+	if sinceString := r.URL.Query().Get("since"); sinceString != "" {
+		t, err := time.Parse(time.RFC3339, sinceString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid since")
+			return
+		}
+		since = t.UTC()
+	}
+
+	states, err := cfg.DB.GetPostStatesSince(r.Context(), database.GetPostStatesSinceParams{
+		UserID:    user.ID,
+		UpdatedAt: since,
+		Limit:     postStatesLimit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get post states")
+		return
+	}
+
+	res := make([]PostState, 0, len(states))
+	for _, state := range states {
+		res = append(res, databasePostStateToPostState(state))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
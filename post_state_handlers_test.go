@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+func TestUpdatePostStateLeavesOtherFields(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New()}
+	postID := uuid.New()
+	state := database.PostState{UserID: user.ID, PostID: postID, Read: true, Starred: true, UpdatedAt: time.Now().UTC()}
+
+	// Only read is sent, so starred and hidden go in as NULL and keep
+	// whatever another device last set them to.
+	mock.ExpectQuery(query("UpsertPostState")).
+		WithArgs(true, isNull{}, isNull{}, timeNear{time.Now().UTC()}, postID, user.ID).
+		WillReturnRows(modelRows(state))
+
+	req := withURLParams(httptest.NewRequest(http.MethodPut, "/v1/posts/"+postID.String()+"/state", bytes.NewBufferString(`{"read":true}`)), "postID", postID.String())
+	w := httptest.NewRecorder()
+	cfg.updatePostStateHandler(w, req, user)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestUpdatePostStateUnfollowedPost(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New()}
+	postID := uuid.New()
+
+	// The upsert selects the post through the user's follows, so it
+	// inserts and returns nothing.
+	mock.ExpectQuery(query("UpsertPostState")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	req := withURLParams(httptest.NewRequest(http.MethodPut, "/v1/posts/"+postID.String()+"/state", bytes.NewBufferString(`{"starred":true}`)), "postID", postID.String())
+	w := httptest.NewRecorder()
+	cfg.updatePostStateHandler(w, req, user)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNotFound, w.Body)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+const (
+	// postStreamHeartbeat is how often an idle stream gets a comment line,
+	// keeping proxies from closing it. The user's follows are refreshed on
+	// the same tick.
+	postStreamHeartbeat = 30 * time.Second
+	// postStreamReplayLimit caps how many missed posts a reconnecting
+	// client is sent.
+	postStreamReplayLimit = 500
+	// postStreamRetry is the reconnection delay suggested to clients.
+	postStreamRetry = 5 * time.Second
+)
+
+// streamPostsHandler pushes posts from the user's followed feeds as
+// server-sent events as soon as they're ingested. Each event's ID is the
+// post ID, so a client that reconnects with Last-Event-ID is first sent
+// the posts it missed.
+func (cfg *apiConfig) streamPostsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var anchor *database.Post
+	if lastEventID != "" {
+		id, err := uuid.Parse(lastEventID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		post, ok := cfg.replayAnchor(w, r, id, "Last-Event-ID")
+		if !ok {
+			return
+		}
+		anchor = &post
+	}
+
+	followed, err := cfg.followedFeedIDs(r, user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feed follows")
+		return
+	}
+
+	// Subscribe before replaying so nothing ingested in between is lost.
+	events, unsubscribe := cfg.Events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", postStreamRetry.Milliseconds())
+
+	sent := map[uuid.UUID]bool{}
+	if anchor != nil {
+		missed, err := cfg.DB.GetPostsByUserSince(r.Context(), database.GetPostsByUserSinceParams{
+			UserID:         user.ID,
+			AfterCreatedAt: anchor.CreatedAt,
+			AfterID:        anchor.ID,
+			Limit:          postStreamReplayLimit,
+		})
+		if err != nil {
+			log.Printf("Couldn't replay posts for %s: %v", user.Name, err)
+			return
+		}
+		for _, post := range missed {
+			if err := writePostEvent(w, post); err != nil {
+				return
+			}
+			sent[post.ID] = true
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(postStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if refreshed, err := cfg.followedFeedIDs(r, user); err == nil {
+				followed = refreshed
+			}
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				// We fell behind; the client will reconnect and replay.
+				return
+			}
+			if e.Post == nil || !followed[e.Post.FeedID] || e.HiddenFor[user.ID] || sent[e.Post.ID] {
+				continue
+			}
+			if err := writePostEvent(w, *e.Post); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// replayAnchor loads the post a reconnecting client last saw, writing an
+// error response and returning false if it no longer exists. Posts can be
+// deleted or moved by a feed merge, and without the anchor we can't tell
+// which posts the client missed, so it has to start over.
+func (cfg *apiConfig) replayAnchor(w http.ResponseWriter, r *http.Request, postID uuid.UUID, param string) (database.Post, bool) {
+	post, err := cfg.DB.GetPostByID(r.Context(), postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown %s, reconnect without it", param))
+		return database.Post{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get post")
+		return database.Post{}, false
+	}
+	return post, true
+}
+
+func (cfg *apiConfig) followedFeedIDs(r *http.Request, user database.User) (map[uuid.UUID]bool, error) {
+	follows, err := cfg.DB.GetFeedFollows(r.Context(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	followed := make(map[uuid.UUID]bool, len(follows))
+	for _, follow := range follows {
+		followed[follow.FeedID] = true
+	}
+	return followed, nil
+}
+
+func writePostEvent(w http.ResponseWriter, post database.Post) error {
+	dat, err := json.Marshal(databasePostToPost(post, nil, postFormatHTML))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: post\ndata: %s\n\n", post.ID, dat)
+	return err
+}
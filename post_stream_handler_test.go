@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+func TestStreamPostsSkipsHiddenPosts(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New(), Name: "ada"}
+	follow := database.FeedFollow{ID: uuid.New(), UserID: user.ID, FeedID: uuid.New()}
+	mock.ExpectQuery(query("GetFeedFollows")).
+		WithArgs(user.ID).
+		WillReturnRows(modelRows(follow))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.streamPostsHandler(w, r, user)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() && !strings.HasPrefix(lines.Text(), "retry:") {
+	}
+
+	hidden := database.Post{ID: uuid.New(), FeedID: follow.FeedID, Title: "Hidden"}
+	visible := database.Post{ID: uuid.New(), FeedID: follow.FeedID, Title: "Visible"}
+	cfg.Events.publishPost(hidden, map[uuid.UUID]bool{user.ID: true})
+	cfg.Events.publishPost(visible, map[uuid.UUID]bool{uuid.New(): true})
+
+	for lines.Scan() {
+		switch lines.Text() {
+		case "id: " + hidden.ID.String():
+			t.Fatal("hidden post was streamed")
+		case "id: " + visible.ID.String():
+			return
+		}
+	}
+	t.Fatalf("stream ended before the visible post: %v", lines.Err())
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// summaryLength is the maximum length, in characters, of a post summary.
+const summaryLength = 280
+
+// blockTags start a new line when converting HTML to text.
+var blockTags = map[string]bool{
+	"blockquote": true,
+	"br":         true,
+	"dd":         true,
+	"div":        true,
+	"dl":         true,
+	"dt":         true,
+	"figcaption": true,
+	"figure":     true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"hr":         true,
+	"li":         true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"table":      true,
+	"tr":         true,
+	"ul":         true,
+}
+
+// htmlToText returns the readable text of an HTML fragment, with one line
+// per block element and whitespace collapsed within lines.
+func htmlToText(fragment string) string {
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	skipDepth := 0
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		name, _ := tokenizer.TagName()
+		tag := string(name)
+		switch tokenType {
+		case html.TextToken:
+			if skipDepth == 0 {
+				line.Write(tokenizer.Text())
+			}
+		case html.StartTagToken:
+			if tag == "script" || tag == "style" {
+				skipDepth++
+			}
+			if blockTags[tag] {
+				flush()
+			}
+		case html.EndTagToken:
+			if (tag == "script" || tag == "style") && skipDepth > 0 {
+				skipDepth--
+			}
+			if blockTags[tag] {
+				flush()
+			}
+		case html.SelfClosingTagToken:
+			if blockTags[tag] {
+				flush()
+			}
+		}
+	}
+	flush()
+	return strings.Join(lines, "\n")
+}
+
+// summarize shortens text to at most summaryLength characters on a single
+// line, cutting at a word boundary and marking the cut with an ellipsis. The
+// ellipsis counts towards the limit.
+func summarize(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= summaryLength {
+		return text
+	}
+	// Keep one rune for the ellipsis. Looking at the rune just past the kept
+	// ones too means a word that ends exactly at the limit isn't dropped.
+	runes := []rune(text)
+	cut := summaryLength - 1
+	for i := cut; i > summaryLength/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
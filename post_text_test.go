@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "Hello  world", "Hello world"},
+		{"entities", "Tom &amp; Jerry", "Tom & Jerry"},
+		{"inline tags", "<p>Some <em>emphasis</em> here</p>", "Some emphasis here"},
+		{"blocks", "<p>One</p><p>Two</p><ul><li>a</li><li>b</li></ul>", "One\nTwo\na\nb"},
+		{"line break", "first<br>second<br/>third", "first\nsecond\nthird"},
+		{"script and style", "<style>p{}</style><p>kept</p><script>alert(1)</script>", "kept"},
+		{"empty blocks", "<div>\n  <p> </p>\n</div>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlToText(tt.in); got != tt.want {
+				t.Errorf("htmlToText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	// summaryLength isn't a multiple of len(word), so the limit falls
+	// inside a word.
+	const word = "abcdefgh "
+	fits := strings.Repeat("x", summaryLength)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"short", "A short post.", "A short post."},
+		{"whitespace collapsed", "  Two\n\nlines\tand  spaces ", "Two lines and spaces"},
+		{"exactly the limit", fits, fits},
+		{"one over the limit", fits + "y", strings.Repeat("x", summaryLength-1) + "…"},
+		{
+			"cut at a word boundary",
+			strings.Repeat(word, summaryLength/len(word)+10),
+			strings.TrimSpace(strings.Repeat(word, summaryLength/len(word))) + "…",
+		},
+		{
+			"word ending at the limit kept",
+			strings.Repeat("x", summaryLength-1) + " tail",
+			strings.Repeat("x", summaryLength-1) + "…",
+		},
+		{
+			"trailing punctuation dropped",
+			strings.Repeat("y", summaryLength-5) + ", and then some more words",
+			strings.Repeat("y", summaryLength-5) + "…",
+		},
+		{
+			"multibyte runes counted once",
+			strings.Repeat("é", summaryLength+5),
+			strings.Repeat("é", summaryLength-1) + "…",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(tt.in)
+			if got != tt.want {
+				t.Errorf("summarize() = %q, want %q", got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > summaryLength {
+				t.Errorf("summary is %d runes, want at most %d", n, summaryLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedTags maps the elements kept by sanitizeHTML to the attributes they
+// may keep. Elements not listed here are unwrapped: their children stay but
+// the element itself is dropped.
+var allowedTags = map[string][]string{
+	"a":          {"href", "title"},
+	"abbr":       {"title"},
+	"audio":      {"src", "controls"},
+	"b":          nil,
+	"blockquote": {"cite"},
+	"br":         nil,
+	"caption":    nil,
+	"cite":       nil,
+	"code":       nil,
+	"dd":         nil,
+	"del":        nil,
+	"div":        nil,
+	"dl":         nil,
+	"dt":         nil,
+	"em":         nil,
+	"figcaption": nil,
+	"figure":     nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "title", "width", "height"},
+	"ins":        nil,
+	"kbd":        nil,
+	"li":         nil,
+	"mark":       nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        nil,
+	"q":          {"cite"},
+	"s":          nil,
+	"small":      nil,
+	"source":     {"src", "type"},
+	"span":       nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"colspan", "rowspan"},
+	"tfoot":      nil,
+	"th":         {"colspan", "rowspan"},
+	"thead":      nil,
+	"time":       {"datetime"},
+	"tr":         nil,
+	"u":          nil,
+	"ul":         nil,
+	"video":      {"src", "poster", "controls"},
+}
+
+// droppedTags are removed together with everything inside them.
+var droppedTags = map[string]bool{
+	"base":     true,
+	"button":   true,
+	"embed":    true,
+	"form":     true,
+	"frame":    true,
+	"frameset": true,
+	"head":     true,
+	"iframe":   true,
+	"input":    true,
+	"link":     true,
+	"meta":     true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"select":   true,
+	"style":    true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+}
+
+var urlAttrs = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"poster": true,
+	"cite":   true,
+}
+
+// sanitizeHTML strips an untrusted HTML fragment down to allowedTags,
+// removes tracking pixels and makes every URL absolute against baseURL.
+func sanitizeHTML(fragment, baseURL string) string {
+	if strings.TrimSpace(fragment) == "" {
+		return ""
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		base = &url.URL{}
+	}
+
+	root := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), root)
+	if err != nil {
+		return ""
+	}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	sanitizeChildren(root, base)
+
+	var buf bytes.Buffer
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func sanitizeChildren(parent *html.Node, base *url.URL) {
+	for c := parent.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			attrs, allowed := allowedTags[c.Data]
+			switch {
+			case c.Namespace != "" || droppedTags[c.Data]:
+				parent.RemoveChild(c)
+			case !allowed:
+				if c.FirstChild != nil {
+					next = c.FirstChild
+				}
+				for gc := c.FirstChild; gc != nil; {
+					following := gc.NextSibling
+					c.RemoveChild(gc)
+					parent.InsertBefore(gc, c)
+					gc = following
+				}
+				parent.RemoveChild(c)
+			default:
+				c.Attr = sanitizeAttrs(c, attrs, base)
+				if isTrackingPixel(c) {
+					parent.RemoveChild(c)
+					break
+				}
+				sanitizeChildren(c, base)
+			}
+		default:
+			parent.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+func sanitizeAttrs(n *html.Node, allowed []string, base *url.URL) []html.Attribute {
+	attrs := []html.Attribute{}
+	for _, attr := range n.Attr {
+		if attr.Namespace != "" || !containsString(allowed, attr.Key) {
+			continue
+		}
+		if urlAttrs[attr.Key] {
+			resolved, ok := resolveSafeURL(attr.Val, base, attr.Key == "href")
+			if !ok {
+				continue
+			}
+			attr.Val = resolved
+		}
+		attrs = append(attrs, attr)
+	}
+	if n.Data == "a" {
+		attrs = append(attrs, html.Attribute{Key: "rel", Val: "noopener noreferrer nofollow"})
+	}
+	return attrs
+}
+
+// resolveSafeURL makes rawURL absolute against base, only allowing http(s)
+// URLs and, for links, mailto.
+func resolveSafeURL(rawURL string, base *url.URL, isLink bool) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", false
+	}
+	u = base.ResolveReference(u)
+	switch u.Scheme {
+	case "http", "https":
+		return u.String(), true
+	case "mailto":
+		return u.String(), isLink
+	}
+	return "", false
+}
+
+// isTrackingPixel reports whether n is an image that can't be meant to be
+// seen: one without a source or sized 1x1 or smaller.
+func isTrackingPixel(n *html.Node) bool {
+	if n.Data != "img" {
+		return false
+	}
+	src, width, height := "", -1, -1
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "src":
+			src = attr.Val
+		case "width":
+			if v, err := strconv.Atoi(strings.TrimSuffix(attr.Val, "px")); err == nil {
+				width = v
+			}
+		case "height":
+			if v, err := strconv.Atoi(strings.TrimSuffix(attr.Val, "px")); err == nil {
+				height = v
+			}
+		}
+	}
+	return src == "" || (width >= 0 && width <= 1) || (height >= 0 && height <= 1)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
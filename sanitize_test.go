@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	const base = "https://blog.example/posts/hello"
+	const rel = ` rel="noopener noreferrer nofollow"`
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "  ", ""},
+		{"plain text", "Tom &amp; Jerry", "Tom &amp; Jerry"},
+		{"allowed markup", "<p>Some <em>emphasis</em> and <code>code</code></p>", "<p>Some <em>emphasis</em> and <code>code</code></p>"},
+
+		{"script", `<p>Hi</p><script>alert(1)</script>`, "<p>Hi</p>"},
+		{"script inside allowed tag", `<div><script src="https://evil.example/x.js"></script>text</div>`, "<div>text</div>"},
+		{"event handlers", `<img src="/a.png" onerror="alert(1)" onload="alert(2)">`, `<img src="https://blog.example/a.png"/>`},
+		{"event handler on link", `<a href="/x" onclick="alert(1)" onmouseover="alert(2)">x</a>`, `<a href="https://blog.example/x"` + rel + `>x</a>`},
+		{"style attribute", `<p style="background:url(javascript:alert(1))">x</p>`, "<p>x</p>"},
+		{"unknown element unwrapped", `<article><p>kept</p></article>`, "<p>kept</p>"},
+		{"iframe", `<iframe src="https://evil.example/"></iframe>after`, "after"},
+		{"form", `<form action="https://evil.example/"><input name="q"></form>after`, "after"},
+
+		{"javascript href", `<a href="javascript:alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"mixed case javascript href", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"javascript href with leading space", `<a href=" javascript:alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"javascript href with tab", "<a href=\"java\tscript:alert(1)\">x</a>", `<a` + rel + `>x</a>`},
+		{"javascript href with control character", "<a href=\"\x01javascript:alert(1)\">x</a>", `<a` + rel + `>x</a>`},
+		{"entity-encoded scheme", `<a href="jav&#x61;script:alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"entity-encoded colon", `<a href="javascript&colon;alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"data href", `<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`, `<a` + rel + `>x</a>`},
+		{"data src", `<img src="data:image/svg+xml;base64,PHN2Zy8+" width="100">`, ""},
+		{"vbscript src", `<video src="vbscript:msgbox(1)" poster="/p.jpg"></video>`, `<video poster="https://blog.example/p.jpg"></video>`},
+		{"mailto link", `<a href="mailto:ada@example.com">mail</a>`, `<a href="mailto:ada@example.com"` + rel + `>mail</a>`},
+		{"mailto src", `<img src="mailto:ada@example.com" width="100">`, ""},
+
+		{"svg", `<p>a</p><svg><script>alert(1)</script><a href="https://x.example/">x</a></svg><p>b</p>`, "<p>a</p><p>b</p>"},
+		{"svg onload", `<svg onload="alert(1)"/>after`, "after"},
+		{"math", `<math><mi xlink:href="javascript:alert(1)">x</mi></math>after`, "after"},
+		{"style element", `<style>body{display:none}</style><p>x</p>`, "<p>x</p>"},
+		{"style inside svg", `<svg><style>@import "https://evil.example/x.css";</style></svg>`, ""},
+
+		{"relative link", `<a href="../about">about</a>`, `<a href="https://blog.example/about"` + rel + `>about</a>`},
+		{"root-relative image", `<img src="/img/a.png" alt="A">`, `<img src="https://blog.example/img/a.png" alt="A"/>`},
+		{"protocol-relative image", `<img src="//cdn.example/a.png">`, `<img src="https://cdn.example/a.png"/>`},
+		{"relative cite", `<blockquote cite="quote">q</blockquote>`, `<blockquote cite="https://blog.example/posts/quote">q</blockquote>`},
+		{"absolute link kept", `<a href="http://other.example/x?a=1&amp;b=2">x</a>`, `<a href="http://other.example/x?a=1&amp;b=2"` + rel + `>x</a>`},
+
+		{"tracking pixel", `<p>x<img src="https://t.example/p.gif" width="1" height="1"></p>`, "<p>x</p>"},
+		{"tracking pixel in px", `<img src="https://t.example/p.gif" width="1px" height="1px">`, ""},
+		{"zero-width pixel", `<img src="https://t.example/p.gif" width="0">`, ""},
+		{"image without source", `<img alt="nothing">`, ""},
+		{"small but visible image", `<img src="/icon.png" width="16" height="16">`, `<img src="https://blog.example/icon.png" width="16" height="16"/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.in, base); got != tt.want {
+				t.Errorf("sanitizeHTML(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
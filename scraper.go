@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strings"
 	"sync"
@@ -17,51 +19,273 @@ import (
 
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Language    string    `xml:"language"`
-		Item        []RSSItem `xml:"item"`
+		// As with RSSItem, namespaced fields come first so atom:link and
+		// itunes:image don't get matched as the plain RSS elements.
+		AtomLinks   []AtomLink `xml:"http://www.w3.org/2005/Atom link"`
+		ITunesImage struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"language"`
+		Image       struct {
+			URL string `xml:"url"`
+		} `xml:"image"`
+		Generator string    `xml:"generator"`
+		Item      []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	// encoding/xml matches un-namespaced tags against any namespace and
+	// uses the first matching field, so these have to come before Title,
+	// Description, Author and Categories to keep the namespaced elements out
+	// of them.
+	ITunesTitle      string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	MediaTitle       string `xml:"http://search.yahoo.com/mrss/ title"`
+	MediaDescription string `xml:"http://search.yahoo.com/mrss/ description"`
+	ITunesAuthor     string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ITunesCategories []struct {
+		Text string `xml:"text,attr"`
+	} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+	MediaCategories []string `xml:"http://search.yahoo.com/mrss/ category"`
+
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	PubDate     string         `xml:"pubDate"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Creators    []string       `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Author      string         `xml:"author"`
+	Categories  []string       `xml:"category"`
+	Comments    string         `xml:"comments"`
+	// FeedBurner rewrites links to go through its redirector and keeps the
+	// original here.
+	FeedburnerOrigLink string `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
+
+	MediaContents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroups     []MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+
+	ITunesDuration string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesImage    struct {
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ITunesSeason  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ITunesEpisode string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+}
+
+// authors returns the item's dc:creator values, falling back to the RSS
+// author element, which is usually formatted "email (Name)".
+func (item RSSItem) authors() []string {
+	authors := []string{}
+	for _, creator := range item.Creators {
+		authors = appendUnique(authors, creator)
+	}
+	if len(authors) == 0 {
+		author := strings.TrimSpace(item.Author)
+		if open := strings.Index(author, "("); open != -1 && strings.HasSuffix(author, ")") {
+			author = author[open+1 : len(author)-1]
+		}
+		authors = appendUnique(authors, author)
+	}
+	return authors
+}
+
+func (item RSSItem) categories() []string {
+	categories := []string{}
+	for _, category := range item.Categories {
+		categories = appendUnique(categories, category)
+	}
+	return categories
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// appendUnique appends s to list unless it's blank or already present.
+func appendUnique(list []string, s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return list
+	}
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+const maxFeedRedirects = 10
+
+// defaultMaxFeedBytes caps feed bodies when MAX_FEED_BYTES isn't set.
+const defaultMaxFeedBytes = 10 << 20
+
+var (
+	errFeedGone     = errors.New("feed is gone (410)")
+	errFeedTooLarge = errors.New("feed body exceeds size limit")
+	errFeedStatus   = errors.New("unexpected status")
+	errNotAFeed     = errors.New("not a feed")
+)
+
+// fetchResult describes how a feed URL resolved while it was fetched.
+type fetchResult struct {
+	// PermanentURL is where the leading run of 301/308 redirects ended,
+	// or empty if the first hop wasn't a permanent redirect.
+	PermanentURL string
+	// HubURL and SelfURL are the WebSub hub and topic advertised in the
+	// response's Link headers, if any.
+	HubURL  string
+	SelfURL string
 }
 
-func fetchFeed(feedURL string) (*RSSFeed, error) {
+func (cfg *apiConfig) fetchFeed(feedURL string) (*RSSFeed, fetchResult, error) {
+	result := fetchResult{}
+	if err := validateFeedURL(feedURL); err != nil {
+		return nil, result, err
+	}
+	permanent := true
 	httpClient := http.Client{
-		Timeout: 10 * time.Second,
+		Transport: cfg.FeedTransport,
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFeedRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFeedRedirects)
+			}
+			if err := validateFeedURL(req.URL.String()); err != nil {
+				return err
+			}
+			code := req.Response.StatusCode
+			if permanent && (code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect) {
+				result.PermanentURL = req.URL.String()
+			} else {
+				permanent = false
+			}
+			return nil
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, result, err
 	}
-	resp, err := httpClient.Get(feedURL)
+	req.Header.Set("Accept-Encoding", feedAcceptEncoding)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, result, err
 	}
 	defer resp.Body.Close()
 
-	dat, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode == http.StatusGone {
+		return nil, result, errFeedGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, result, fmt.Errorf("%w %s", errFeedStatus, resp.Status)
+	}
+	links := parseLinkHeader(resp.Header.Values("Link"), resp.Request.URL)
+	result.HubURL = links["hub"]
+	result.SelfURL = links["self"]
+	contentType := resp.Header.Get("Content-Type")
+	if !isFeedContentType(contentType) {
+		return nil, result, fmt.Errorf("%w: unexpected content type %q", errNotAFeed, contentType)
+	}
+	if resp.ContentLength > cfg.MaxFeedBytes {
+		return nil, result, errFeedTooLarge
 	}
 
 	var rssFeed RSSFeed
-	err = xml.Unmarshal(dat, &rssFeed)
+	decoded, err := decodeResponseBody(resp)
+	if err != nil {
+		return nil, result, fmt.Errorf("%w: %w", errNotAFeed, err)
+	}
+	body := &maxBytesReader{r: decoded, max: cfg.MaxFeedBytes}
+	decoder, err := newFeedDecoder(body, contentType)
+	if err != nil {
+		return nil, result, fmt.Errorf("%w: unsupported charset: %w", errNotAFeed, err)
+	}
+	err = decoder.Decode(&rssFeed)
+	if err != nil {
+		if errors.Is(err, errFeedTooLarge) {
+			return nil, result, errFeedTooLarge
+		}
+		return nil, result, fmt.Errorf("%w: couldn't parse feed: %w", errNotAFeed, err)
+	}
+
+	return &rssFeed, result, nil
+}
+
+// isFeedContentType reports whether a response with the given Content-Type
+// could plausibly hold a feed. Plenty of servers mislabel feeds as text/html
+// or send no type at all, so only clearly non-textual types are rejected.
+func isFeedContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		return nil, err
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.Contains(mediaType, "xml"),
+		strings.Contains(mediaType, "rss"),
+		strings.Contains(mediaType, "atom"),
+		mediaType == "application/octet-stream":
+		return true
 	}
+	return false
+}
 
-	return &rssFeed, nil
+// maxBytesReader reads from r until more than max bytes have been read, after
+// which it fails with errFeedTooLarge.
+type maxBytesReader struct {
+	r    io.Reader
+	max  int64
+	read int64
 }
 
-func startScraping(db *database.Queries, concurrency int, timeBetweenRequest time.Duration) {
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.read > m.max {
+		return 0, errFeedTooLarge
+	}
+	if left := m.max - m.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := m.r.Read(p)
+	m.read += int64(n)
+	if m.read > m.max {
+		return n, errFeedTooLarge
+	}
+	return n, err
+}
+
+func (cfg *apiConfig) startScraping(concurrency int, timeBetweenRequest time.Duration) {
 	log.Printf("Collecting feeds every %s on %v goroutiness...", timeBetweenRequest, concurrency)
 	ticker := time.NewTicker(timeBetweenRequest)
 
 	for ; ; <-ticker.C {
-		feeds, err := db.GetNextFeedsToFetch(context.Background(), int32(concurrency))
+		feeds, err := cfg.DB.GetNextFeedsToFetch(context.Background(), int32(concurrency))
 		if err != nil {
 			log.Println("Couldn't get next feeds to fetch", err)
 			continue
@@ -71,27 +295,70 @@ func startScraping(db *database.Queries, concurrency int, timeBetweenRequest tim
 		wg := &sync.WaitGroup{}
 		for _, feed := range feeds {
 			wg.Add(1)
-			go scrapeFeed(db, wg, feed)
+			go cfg.scrapeFeed(wg, feed)
 		}
 		wg.Wait()
 	}
 }
 
-func scrapeFeed(db *database.Queries, wg *sync.WaitGroup, feed database.Feed) {
+func (cfg *apiConfig) scrapeFeed(wg *sync.WaitGroup, feed database.Feed) {
 	defer wg.Done()
-	_, err := db.MarkFeedFetched(context.Background(), feed.ID)
+	_, err := cfg.DB.MarkFeedFetched(context.Background(), feed.ID)
 	if err != nil {
 		log.Printf("Couldn't mark feed %s fetched: %v", feed.Name, err)
 		return
 	}
 
-	feedData, err := fetchFeed(feed.Url)
+	feedData, result, err := cfg.fetchFeed(feed.Url)
+	if err != nil {
+		cfg.recordFeedError(feed, err)
+	}
+	if errors.Is(err, errFeedGone) {
+		log.Printf("Feed %s is gone, marking it dead", feed.Name)
+		err = cfg.DB.MarkFeedDead(context.Background(), feed.ID)
+		if err != nil {
+			log.Printf("Couldn't mark feed %s dead: %v", feed.Name, err)
+		}
+		return
+	}
 	if err != nil {
 		log.Printf("Couldn't collect feed %s: %v", feed.Name, err)
 		return
 	}
+	if feed.LastError.Valid {
+		cfg.recordFeedError(feed, nil)
+	}
+
+	feed, err = cfg.handleFeedRedirect(context.Background(), feed, result)
+	if err != nil {
+		log.Printf("Couldn't update redirected feed %s: %v", feed.Name, err)
+	}
+
+	cfg.ingestFeed(context.Background(), feed, feedData)
+	cfg.ensureWebSub(context.Background(), feed, feedData, result)
+}
+
+// ingestFeed stores a fetched or pushed copy of a feed: its metadata and
+// any items we haven't seen before.
+func (cfg *apiConfig) ingestFeed(ctx context.Context, feed database.Feed, feedData *RSSFeed) {
+	cfg.updateFeedMetadata(ctx, feed, feedData)
 
+	channelLink := canonicalizeURL(feedData.Channel.Link, feed.Url)
+	// Filter rules are loaded the first time a new post needs them, so
+	// fetches that find nothing new don't query for them at all.
+	var matchers []filterMatcher
+	matchersLoaded := false
 	for _, item := range feedData.Channel.Item {
+		link := canonicalizeURL(firstNonEmpty(item.FeedburnerOrigLink, item.Link), channelLink)
+		baseURL := link
+		if baseURL == "" {
+			baseURL = channelLink
+		}
+
+		sanitizedDescription := sanitizeHTML(item.Description, baseURL)
+		sanitizedContent := sanitizeHTML(item.Content, baseURL)
+		text := htmlToText(firstNonEmpty(sanitizedContent, sanitizedDescription))
+
 		publishedAt := sql.NullTime{}
 		if t, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
 			publishedAt = sql.NullTime{
@@ -100,8 +367,9 @@ func scrapeFeed(db *database.Queries, wg *sync.WaitGroup, feed database.Feed) {
 			}
 		}
 
+		postID := uuid.New()
 		createPostParams := database.CreatePostParams{
-			ID:        uuid.New(),
+			ID:        postID,
 			CreatedAt: time.Now().UTC(),
 			UpdatedAt: time.Now().UTC(),
 			FeedID:    feed.ID,
@@ -110,10 +378,20 @@ func scrapeFeed(db *database.Queries, wg *sync.WaitGroup, feed database.Feed) {
 				String: item.Description,
 				Valid:  true,
 			},
-			Url:         item.Link,
-			PublishedAt: publishedAt,
+			Url:                  link,
+			PublishedAt:          publishedAt,
+			Content:              toNullString(item.Content),
+			Authors:              item.authors(),
+			Categories:           item.categories(),
+			CommentsUrl:          toNullString(item.Comments),
+			ThumbnailUrl:         toNullString(item.thumbnailURL(baseURL)),
+			SanitizedDescription: toNullString(sanitizedDescription),
+			SanitizedContent:     toNullString(sanitizedContent),
+			TextContent:          toNullString(text),
+			Summary:              toNullString(summarize(text)),
+			ClusterID:            postID,
 		}
-		_, err = db.CreatePost(context.Background(), createPostParams)
+		post, err := cfg.DB.CreatePost(ctx, createPostParams)
 		if err != nil {
 			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
 				continue
@@ -121,6 +399,85 @@ func scrapeFeed(db *database.Queries, wg *sync.WaitGroup, feed database.Feed) {
 			log.Printf("Couldn't create post: %v", err)
 			continue
 		}
+
+		cfg.createEnclosures(ctx, post, item)
+		if err := cfg.assignCluster(ctx, post); err != nil {
+			log.Printf("Couldn't cluster post %s: %v", post.Url, err)
+		}
+		if feed.ExtractFullContent && post.Url != "" {
+			err := cfg.DB.QueueArticleExtraction(ctx, database.QueueArticleExtractionParams{
+				PostID:   post.ID,
+				QueuedAt: time.Now().UTC(),
+			})
+			if err != nil {
+				log.Printf("Couldn't queue article extraction for post %s: %v", post.Url, err)
+			}
+		}
+		if !matchersLoaded {
+			matchers = cfg.filterMatchersForFeed(ctx, feed.ID)
+			matchersLoaded = true
+		}
+		hiddenFor := cfg.applyFilterRules(ctx, matchers, post)
+		cfg.queueWebhooks(ctx, post, hiddenFor)
+		cfg.Events.publishPost(post, hiddenFor)
 	}
 	log.Printf("Feed %s collected, %v posts found", feed.Name, len(feedData.Channel.Item))
 }
+
+// recordFeedError stores why the last fetch of feed failed, or clears the
+// stored reason when err is nil.
+func (cfg *apiConfig) recordFeedError(feed database.Feed, err error) {
+	lastError := sql.NullString{}
+	if err != nil {
+		lastError = sql.NullString{
+			String: feedErrorReason(err),
+			Valid:  true,
+		}
+	}
+	err = cfg.DB.SetFeedError(context.Background(), database.SetFeedErrorParams{
+		ID:        feed.ID,
+		LastError: lastError,
+	})
+	if err != nil {
+		log.Printf("Couldn't record error for feed %s: %v", feed.Name, err)
+	}
+}
+
+// feedErrorReason sums up why a fetch failed for GET /v1/feeds, which
+// anyone can read. Network errors name the addresses we tried to reach, so
+// they're reported only as unreachable; the details are logged.
+func feedErrorReason(err error) string {
+	switch {
+	case errors.Is(err, errFeedGone):
+		return "gone"
+	case errors.Is(err, errFeedTooLarge):
+		return "too large"
+	case errors.Is(err, errFeedStatus):
+		return err.Error()
+	case errors.Is(err, errNotAFeed):
+		return "not a feed"
+	}
+	return "unreachable"
+}
+
+// updateFeedMetadata stores the channel-level details of a freshly fetched
+// feed.
+func (cfg *apiConfig) updateFeedMetadata(ctx context.Context, feed database.Feed, feedData *RSSFeed) {
+	channel := feedData.Channel
+	imageURL := resolveImageURL(channel.Image.URL, channel.Link)
+	if imageURL == "" {
+		imageURL = resolveImageURL(channel.ITunesImage.Href, channel.Link)
+	}
+
+	err := cfg.DB.UpdateFeedMetadata(ctx, database.UpdateFeedMetadataParams{
+		ID:          feed.ID,
+		SiteUrl:     toNullString(channel.Link),
+		Description: toNullString(channel.Description),
+		Language:    toNullString(channel.Language),
+		ImageUrl:    toNullString(imageURL),
+		Generator:   toNullString(channel.Generator),
+	})
+	if err != nil {
+		log.Printf("Couldn't update metadata for feed %s: %v", feed.Name, err)
+	}
+}
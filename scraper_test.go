@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readFeedFixture(t *testing.T, name string) RSSFeed {
+	t.Helper()
+	dat, err := os.ReadFile(filepath.Join("testdata", "feeds", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed := RSSFeed{}
+	if err := xml.Unmarshal(dat, &feed); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return feed
+}
+
+func TestRSSItemNamespacedFields(t *testing.T) {
+	feed := readFeedFixture(t, "namespaced-fields.xml")
+	if len(feed.Channel.Item) != 1 {
+		t.Fatalf("got %d items, want 1", len(feed.Channel.Item))
+	}
+	item := feed.Channel.Item[0]
+
+	if item.Title != "Episode 12: Plain title" {
+		t.Errorf("Title = %q", item.Title)
+	}
+	if got, want := item.authors(), []string{"Plain Author"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("authors() = %q, want %q", got, want)
+	}
+	if got, want := item.categories(), []string{"Technology", "Go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("categories() = %q, want %q", got, want)
+	}
+}
+
+func TestRSSItemMediaRSSText(t *testing.T) {
+	feed := readFeedFixture(t, "media-rss.xml")
+	want := []struct {
+		title       string
+		description string
+	}{
+		{"Photo essay", "Plain description"},
+		{"Video", "Second description"},
+	}
+	if len(feed.Channel.Item) != len(want) {
+		t.Fatalf("got %d items, want %d", len(feed.Channel.Item), len(want))
+	}
+	for i, item := range feed.Channel.Item {
+		if item.Title != want[i].title {
+			t.Errorf("item %d: Title = %q, want %q", i, item.Title, want[i].title)
+		}
+		if item.Description != want[i].description {
+			t.Errorf("item %d: Description = %q, want %q", i, item.Description, want[i].description)
+		}
+	}
+}
+
+func TestFeedErrorReason(t *testing.T) {
+	respond := func(status int, contentType, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}
+	}
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		url       string
+		transport http.RoundTripper
+		want      string
+	}{
+		{name: "gone", handler: respond(http.StatusGone, "text/plain", ""), want: "gone"},
+		{name: "bad status", handler: respond(http.StatusBadGateway, "text/plain", ""), want: "unexpected status 502 Bad Gateway"},
+		{name: "json", handler: respond(http.StatusOK, "application/json", "{}"), want: "not a feed"},
+		{name: "malformed", handler: respond(http.StatusOK, "application/rss+xml", "<rss><channel>"), want: "not a feed"},
+		{name: "connection refused", url: closed.URL, want: "unreachable"},
+		{
+			name:      "blocked address",
+			handler:   respond(http.StatusOK, "application/rss+xml", "<rss/>"),
+			transport: newFeedTransport(&addressGuard{}),
+			want:      "unreachable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feedURL := tt.url
+			if tt.handler != nil {
+				server := httptest.NewServer(tt.handler)
+				t.Cleanup(server.Close)
+				feedURL = server.URL
+			}
+			cfg := &apiConfig{FeedTransport: http.DefaultTransport, MaxFeedBytes: defaultMaxFeedBytes}
+			if tt.transport != nil {
+				cfg.FeedTransport = tt.transport
+			}
+
+			_, _, err := cfg.fetchFeed(feedURL)
+			if err == nil {
+				t.Fatal("fetchFeed succeeded")
+			}
+			got := feedErrorReason(err)
+			if got != tt.want {
+				t.Errorf("feedErrorReason(%v) = %q, want %q", err, got, tt.want)
+			}
+			if strings.Contains(got, "127.0.0.1") {
+				t.Errorf("reason %q names an address", got)
+			}
+		})
+	}
+}
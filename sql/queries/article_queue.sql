@@ -0,0 +1,17 @@
+-- name: QueueArticleExtraction :exec
+INSERT INTO article_queue (post_id, queued_at)
+VALUES ($1, $2)
+ON CONFLICT (post_id) DO NOTHING;
+
+-- name: ClaimQueuedArticles :many
+DELETE FROM article_queue
+WHERE post_id IN (
+  SELECT post_id FROM article_queue
+  ORDER BY queued_at
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING post_id;
+
+-- name: GetPostsByIDs :many
+SELECT * FROM posts WHERE id = ANY(sqlc.arg(ids)::uuid[]);
\ No newline at end of file
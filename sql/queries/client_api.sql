@@ -0,0 +1,70 @@
+-- name: GetFollowedFeeds :many
+SELECT feeds.* FROM feeds
+JOIN feed_follows ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feeds.seq;
+
+-- name: GetFeedBySeq :one
+SELECT * FROM feeds WHERE seq = $1;
+
+-- name: GetPostBySeq :one
+SELECT * FROM posts WHERE seq = $1;
+
+-- name: GetClientItems :many
+SELECT posts.*,
+  COALESCE(post_states.read, FALSE)::bool AS is_read,
+  COALESCE(post_states.starred, FALSE)::bool AS is_starred
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND NOT COALESCE(post_states.hidden, FALSE)
+AND posts.seq > sqlc.arg(min_seq)
+AND posts.seq < sqlc.arg(max_seq)
+AND (cardinality(sqlc.arg(seqs)::bigint[]) = 0 OR posts.seq = ANY(sqlc.arg(seqs)::bigint[]))
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND (sqlc.narg(read)::bool IS NULL OR COALESCE(post_states.read, FALSE) = sqlc.narg(read))
+AND (sqlc.narg(starred)::bool IS NULL OR COALESCE(post_states.starred, FALSE) = sqlc.narg(starred))
+AND (sqlc.narg(newer_than)::timestamp IS NULL OR posts.created_at > sqlc.narg(newer_than))
+AND (sqlc.narg(older_than)::timestamp IS NULL OR posts.created_at < sqlc.narg(older_than))
+ORDER BY CASE WHEN sqlc.arg(newest_first)::bool THEN -posts.seq ELSE posts.seq END
+LIMIT sqlc.arg(limit);
+
+-- name: CountClientItems :one
+SELECT COUNT(*) FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND NOT COALESCE(post_states.hidden, FALSE);
+
+-- name: GetUnreadPostSeqs :many
+SELECT posts.seq FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND NOT COALESCE(post_states.read, FALSE)
+AND NOT COALESCE(post_states.hidden, FALSE)
+ORDER BY posts.seq;
+
+-- name: GetStarredPostSeqs :many
+SELECT posts.seq FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND post_states.starred
+AND NOT post_states.hidden
+ORDER BY posts.seq;
+
+-- name: MarkPostsReadBefore :many
+INSERT INTO post_states (user_id, post_id, read, starred, hidden, updated_at)
+SELECT feed_follows.user_id, posts.id, TRUE, FALSE, FALSE, sqlc.arg(updated_at)::timestamp
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states existing ON existing.post_id = posts.id AND existing.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND CASE WHEN sqlc.arg(by_published)::bool THEN COALESCE(posts.published_at, posts.created_at) ELSE posts.created_at END <= sqlc.arg(before)::timestamp
+AND NOT COALESCE(existing.read, FALSE)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, updated_at = EXCLUDED.updated_at
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,38 @@
+-- name: CreateCollection :one
+INSERT INTO collections (id, created_at, updated_at, user_id, name, slug, description)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetCollectionsByUser :many
+SELECT * FROM collections WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetCollectionBySlug :one
+SELECT * FROM collections WHERE slug = $1;
+
+-- name: GetCollectionForUser :one
+SELECT * FROM collections WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteCollection :exec
+DELETE FROM collections
+WHERE id = $1 AND user_id = $2;
+
+-- name: AddPostToCollection :exec
+INSERT INTO collection_posts (collection_id, post_id, added_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: RemovePostFromCollection :exec
+DELETE FROM collection_posts
+WHERE collection_id = $1 AND post_id = $2;
+
+-- name: GetCollectionPosts :many
+SELECT posts.* FROM posts
+JOIN collection_posts ON collection_posts.post_id = posts.id
+WHERE collection_posts.collection_id = $1
+ORDER BY collection_posts.added_at DESC
+LIMIT $2;
+
+-- name: TouchCollection :exec
+UPDATE collections SET updated_at = NOW()
+WHERE id = $1;
\ No newline at end of file
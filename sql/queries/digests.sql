@@ -0,0 +1,51 @@
+-- name: GetDigestSettings :one
+SELECT * FROM digest_settings
+WHERE user_id = $1;
+
+-- name: UpsertDigestSettings :one
+INSERT INTO digest_settings (user_id, created_at, updated_at, email, frequency, send_hour, weekday, feed_ids, enabled, verification_token)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+  email = EXCLUDED.email,
+  frequency = EXCLUDED.frequency,
+  send_hour = EXCLUDED.send_hour,
+  weekday = EXCLUDED.weekday,
+  feed_ids = EXCLUDED.feed_ids,
+  enabled = EXCLUDED.enabled,
+  email_verified_at = CASE WHEN digest_settings.email = EXCLUDED.email
+    THEN digest_settings.email_verified_at END,
+  verification_token = CASE WHEN digest_settings.email = EXCLUDED.email
+    AND digest_settings.email_verified_at IS NOT NULL
+    THEN NULL ELSE EXCLUDED.verification_token END
+RETURNING *;
+
+-- name: VerifyDigestEmail :execrows
+UPDATE digest_settings
+SET email_verified_at = NOW(), verification_token = NULL, updated_at = NOW()
+WHERE verification_token = $1;
+
+-- name: DeleteDigestSettings :exec
+DELETE FROM digest_settings
+WHERE user_id = $1;
+
+-- name: GetEnabledDigestSettings :many
+SELECT * FROM digest_settings
+WHERE enabled AND email_verified_at IS NOT NULL;
+
+-- name: MarkDigestSent :exec
+UPDATE digest_settings
+SET last_sent_at = $2
+WHERE user_id = $1;
+
+-- name: GetUnreadPostsForDigest :many
+SELECT posts.* FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND posts.created_at > sqlc.arg(since)
+AND NOT COALESCE(post_states.read, FALSE)
+AND NOT COALESCE(post_states.hidden, FALSE)
+AND (cardinality(sqlc.arg(feed_ids)::uuid[]) = 0 OR posts.feed_id = ANY(sqlc.arg(feed_ids)::uuid[]))
+ORDER BY posts.feed_id, posts.created_at DESC
+LIMIT sqlc.arg(limit);
\ No newline at end of file
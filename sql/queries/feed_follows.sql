@@ -8,4 +8,16 @@ SELECT * FROM feed_follows WHERE user_id = $1;
 
 -- name: DeleteFeedFollow :exec
 DELETE FROM feed_follows
-WHERE id = $1 and user_id = $2;
\ No newline at end of file
+WHERE id = $1 and user_id = $2;
+
+-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = sqlc.arg(new_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(old_feed_id)
+AND user_id NOT IN (
+  SELECT user_id FROM feed_follows WHERE feed_id = sqlc.arg(new_feed_id)
+);
+
+-- name: DeleteFeedFollowByFeed :exec
+DELETE FROM feed_follows
+WHERE user_id = $1 AND feed_id = $2;
\ No newline at end of file
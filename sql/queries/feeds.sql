@@ -6,8 +6,19 @@ RETURNING *;
 -- name: GetFeeds :many
 SELECT * from feeds;
 
+-- name: GetFeedByURL :one
+SELECT * FROM feeds WHERE url = $1;
+
 -- name: GetNextFeedsToFetch :many
 SELECT * FROM feeds
+WHERE dead_at IS NULL
+AND NOT EXISTS (
+  SELECT 1 FROM websub_subscriptions
+  WHERE websub_subscriptions.feed_id = feeds.id
+  AND websub_subscriptions.state = 'active'
+  AND websub_subscriptions.lease_expires_at > NOW()
+  AND feeds.last_fetched_at > NOW() - INTERVAL '1 day'
+)
 ORDER BY last_fetched_at NULLS FIRST
 LIMIT $1;
 
@@ -15,4 +26,51 @@ LIMIT $1;
 UPDATE feeds 
 SET last_fetched_at = NOW(), updated_at = NOW()
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: RequestFeedRefetch :execrows
+UPDATE feeds
+SET last_fetched_at = NULL, updated_at = NOW()
+WHERE id = sqlc.arg(id) AND last_fetched_at < sqlc.arg(fetched_before);
+
+-- name: SetFeedRedirect :exec
+UPDATE feeds
+SET redirect_url = $2, redirect_count = $3, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateFeedURL :exec
+UPDATE feeds
+SET url = $2, redirect_url = NULL, redirect_count = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkFeedDead :exec
+UPDATE feeds
+SET dead_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1;
+
+-- name: SetFeedError :exec
+UPDATE feeds
+SET last_error = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET site_url = $2,
+  description = $3,
+  language = $4,
+  image_url = $5,
+  generator = $6,
+  updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetFeedExtractFullContent :one
+UPDATE feeds
+SET extract_full_content = $2, updated_at = NOW()
+WHERE id = $1 AND user_id = $3
+RETURNING *;
+
+-- name: GetFeedByID :one
+SELECT * FROM feeds WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, created_at, updated_at, user_id, feed_id, field, match_type, pattern, action, tag_name, enabled)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING *;
+
+-- name: GetFilterRulesByUser :many
+SELECT * FROM filter_rules WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetFilterRuleForUser :one
+SELECT * FROM filter_rules WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteFilterRule :exec
+DELETE FROM filter_rules
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetFilterRulesForFeed :many
+SELECT filter_rules.* FROM filter_rules
+JOIN feed_follows ON feed_follows.user_id = filter_rules.user_id
+WHERE feed_follows.feed_id = sqlc.arg(feed_id)
+AND filter_rules.enabled
+AND (filter_rules.feed_id IS NULL OR filter_rules.feed_id = sqlc.arg(feed_id))
+ORDER BY filter_rules.created_at;
+
+-- name: GetFollowedPosts :many
+SELECT posts.* FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+ORDER BY posts.created_at DESC
+LIMIT sqlc.arg(limit);
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- name: CreatePostEnclosure :one
+INSERT INTO post_enclosures (
+  id,
+  created_at,
+  updated_at,
+  post_id,
+  url,
+  length,
+  mime_type,
+  duration_seconds,
+  image_url,
+  season,
+  episode
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING *;
+
+-- name: GetEnclosuresForPosts :many
+SELECT * FROM post_enclosures
+WHERE post_id = ANY(sqlc.arg(post_ids)::uuid[])
+ORDER BY created_at;
\ No newline at end of file
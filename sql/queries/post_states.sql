@@ -0,0 +1,22 @@
+-- name: UpsertPostState :one
+INSERT INTO post_states (user_id, post_id, read, starred, hidden, updated_at)
+SELECT feed_follows.user_id, posts.id,
+  COALESCE(sqlc.narg(read)::bool, FALSE),
+  COALESCE(sqlc.narg(starred)::bool, FALSE),
+  COALESCE(sqlc.narg(hidden)::bool, FALSE),
+  sqlc.arg(updated_at)::timestamp
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = sqlc.arg(post_id) AND feed_follows.user_id = sqlc.arg(user_id)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = COALESCE(sqlc.narg(read), post_states.read),
+  starred = COALESCE(sqlc.narg(starred), post_states.starred),
+  hidden = COALESCE(sqlc.narg(hidden), post_states.hidden),
+  updated_at = sqlc.arg(updated_at)
+RETURNING *;
+
+-- name: GetPostStatesSince :many
+SELECT * FROM post_states
+WHERE user_id = $1 AND updated_at > $2
+ORDER BY updated_at
+LIMIT $3;
\ No newline at end of file
@@ -7,14 +7,101 @@ INSERT INTO posts (
   url,
   description,
   published_at,
-  feed_id
+  feed_id,
+  content,
+  authors,
+  categories,
+  comments_url,
+  thumbnail_url,
+  sanitized_description,
+  sanitized_content,
+  text_content,
+  summary,
+  cluster_id
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 RETURNING *;
 
 -- name: GetPostsByUser :many
 SELECT posts.* FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
-WHERE feed_follows.user_id = $1
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND NOT COALESCE(post_states.hidden, FALSE)
+AND (sqlc.narg(author)::text IS NULL OR sqlc.narg(author) = ANY(posts.authors))
+AND (sqlc.narg(category)::text IS NULL OR sqlc.narg(category) = ANY(posts.categories))
+AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+  SELECT 1 FROM post_tags
+  JOIN tags ON tags.id = post_tags.tag_id
+  WHERE post_tags.post_id = posts.id
+  AND tags.user_id = sqlc.arg(user_id)
+  AND tags.name = sqlc.narg(tag)
+))
+AND (NOT sqlc.arg(collapse)::bool OR posts.id = (
+  SELECT p2.id FROM posts p2
+  JOIN feed_follows ff2 ON ff2.feed_id = p2.feed_id
+  LEFT JOIN post_states ps2 ON ps2.post_id = p2.id AND ps2.user_id = ff2.user_id
+  WHERE ff2.user_id = sqlc.arg(user_id) AND p2.cluster_id = posts.cluster_id
+  AND NOT COALESCE(ps2.hidden, FALSE)
+  AND (sqlc.narg(author)::text IS NULL OR sqlc.narg(author) = ANY(p2.authors))
+  AND (sqlc.narg(category)::text IS NULL OR sqlc.narg(category) = ANY(p2.categories))
+  AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_tags
+    JOIN tags ON tags.id = post_tags.tag_id
+    WHERE post_tags.post_id = p2.id
+    AND tags.user_id = sqlc.arg(user_id)
+    AND tags.name = sqlc.narg(tag)
+  ))
+  ORDER BY p2.created_at, p2.id
+  LIMIT 1
+))
 ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+LIMIT sqlc.arg(limit);
+
+-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = sqlc.arg(new_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(old_feed_id)
+AND url NOT IN (
+  SELECT url FROM posts WHERE feed_id = sqlc.arg(new_feed_id)
+);
+
+-- name: UpdatePostArticle :exec
+UPDATE posts
+SET article_content = $2, text_content = $3, summary = $4, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetClusterByURL :one
+SELECT cluster_id FROM posts
+WHERE url = $1 AND feed_id <> $2
+ORDER BY created_at
+LIMIT 1;
+
+-- name: GetRecentPostTitles :many
+SELECT id, title, cluster_id FROM posts
+WHERE feed_id <> $1 AND created_at > $2
+ORDER BY created_at DESC
+LIMIT 2000;
+
+-- name: SetPostCluster :exec
+UPDATE posts
+SET cluster_id = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetPostsByUserSince :many
+SELECT posts.* FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND NOT COALESCE(post_states.hidden, FALSE)
+AND (posts.created_at, posts.id) > (sqlc.arg(after_created_at)::timestamp, sqlc.arg(after_id)::uuid)
+ORDER BY posts.created_at, posts.id
+LIMIT sqlc.arg(limit);
+
+-- name: GetFollowedPost :one
+SELECT posts.* FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = sqlc.arg(id) AND feed_follows.user_id = sqlc.arg(user_id);
+
+-- name: GetPostByID :one
+SELECT * FROM posts WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,37 @@
+-- name: UpsertTag :one
+INSERT INTO tags (id, created_at, updated_at, user_id, name)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, name) DO UPDATE
+SET updated_at = tags.updated_at
+RETURNING *;
+
+-- name: AddPostTag :exec
+INSERT INTO post_tags (tag_id, post_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: CreateTag :one
+INSERT INTO tags (id, created_at, updated_at, user_id, name)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetTagsByUser :many
+SELECT * FROM tags WHERE user_id = $1
+ORDER BY name;
+
+-- name: RenameTag :one
+UPDATE tags
+SET name = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteTag :exec
+DELETE FROM tags
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetTagForUser :one
+SELECT * FROM tags WHERE id = $1 AND user_id = $2;
+
+-- name: RemovePostTag :exec
+DELETE FROM post_tags
+WHERE tag_id = $1 AND post_id = $2;
\ No newline at end of file
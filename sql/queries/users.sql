@@ -1,7 +1,41 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name, api_key)
-VALUES ($1, $2, $3, $4, encode(sha256(random()::text::bytea), 'hex'))
+INSERT INTO users (id, created_at, updated_at, name, api_key, feed_token)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING *;
 
 -- name: GetUserByAPIKey :one
 SELECT * FROM users WHERE api_key = $1;
+
+-- name: GetUserByFeedToken :one
+SELECT * FROM users WHERE feed_token = $1;
+
+-- name: RotateUserFeedToken :one
+UPDATE users
+SET feed_token = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: GetUserByFeverAPIKey :one
+SELECT * FROM users WHERE fever_api_key = $1;
+
+-- name: SetUserClientPassword :exec
+UPDATE users
+SET client_password_hash = $2, fever_api_key = $3, greader_auth_token = NULL, greader_auth_expires_at = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserByClientLoginName :one
+SELECT * FROM users
+WHERE name = $1 AND client_password_hash IS NOT NULL;
+
+-- name: GetUserByGReaderAuthToken :one
+SELECT * FROM users
+WHERE greader_auth_token = $1 AND greader_auth_expires_at > $2;
+
+-- name: SetUserGReaderAuthToken :one
+UPDATE users
+SET greader_auth_token = $2, greader_auth_expires_at = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,60 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, user_id, url, secret, feed_id, keyword)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetWebhooksByUser :many
+SELECT * FROM webhooks WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetWebhookByID :one
+SELECT * FROM webhooks WHERE id = $1;
+
+-- name: GetWebhookForUser :one
+SELECT * FROM webhooks WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteWebhook :exec
+DELETE FROM webhooks
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebhooksForFeed :many
+SELECT webhooks.* FROM webhooks
+JOIN feed_follows ON feed_follows.user_id = webhooks.user_id
+WHERE feed_follows.feed_id = sqlc.arg(feed_id)
+AND (webhooks.feed_id IS NULL OR webhooks.feed_id = sqlc.arg(feed_id));
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, updated_at, webhook_id, post_id, event, payload, status, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET status = 'sending', updated_at = sqlc.arg(now)
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE (status = 'pending' AND next_attempt_at <= sqlc.arg(now))
+  OR (status = 'sending' AND next_attempt_at IS NOT NULL AND updated_at <= sqlc.arg(stale_before))
+  ORDER BY next_attempt_at
+  LIMIT sqlc.arg(limit)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RecordWebhookAttempt :one
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+  status = $2,
+  response_status = $3,
+  last_error = $4,
+  next_attempt_at = $5,
+  delivered_at = $6,
+  updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
\ No newline at end of file
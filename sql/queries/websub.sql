@@ -0,0 +1,43 @@
+-- name: GetWebSubSubscription :one
+SELECT * FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: UpsertWebSubSubscription :one
+INSERT INTO websub_subscriptions (feed_id, created_at, updated_at, hub_url, topic_url, secret, state)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (feed_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+  hub_url = EXCLUDED.hub_url,
+  topic_url = EXCLUDED.topic_url,
+  secret = EXCLUDED.secret,
+  state = EXCLUDED.state,
+  pending_secret = NULL,
+  last_error = NULL
+RETURNING *;
+
+-- name: ActivateWebSubSubscription :exec
+UPDATE websub_subscriptions
+SET state = 'active',
+  secret = COALESCE(pending_secret, secret),
+  pending_secret = NULL,
+  lease_expires_at = $2,
+  last_error = NULL,
+  updated_at = NOW()
+WHERE feed_id = $1;
+
+-- name: SetWebSubPendingSecret :exec
+UPDATE websub_subscriptions
+SET pending_secret = $2, updated_at = NOW()
+WHERE feed_id = $1;
+
+-- name: SetWebSubSubscriptionState :exec
+UPDATE websub_subscriptions
+SET state = $2, last_error = $3, updated_at = NOW()
+WHERE feed_id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+SELECT * FROM websub_subscriptions
+WHERE (state = 'active' AND lease_expires_at < sqlc.arg(renew_before))
+OR (state IN ('pending', 'failed') AND updated_at < sqlc.arg(retry_before))
+ORDER BY updated_at
+LIMIT sqlc.arg(limit);
\ No newline at end of file
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE post_enclosures (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  length BIGINT,
+  mime_type TEXT,
+  duration_seconds INTEGER,
+  image_url TEXT,
+  season INTEGER,
+  episode INTEGER,
+  UNIQUE (post_id, url)
+);
+
+
+-- +goose Down
+DROP TABLE post_enclosures;
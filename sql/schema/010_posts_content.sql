@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN content TEXT;
+ALTER TABLE posts ADD COLUMN authors TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE posts ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE posts ADD COLUMN comments_url TEXT;
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN comments_url;
+ALTER TABLE posts DROP COLUMN categories;
+ALTER TABLE posts DROP COLUMN authors;
+ALTER TABLE posts DROP COLUMN content;
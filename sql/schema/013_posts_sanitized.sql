@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN sanitized_description TEXT;
+ALTER TABLE posts ADD COLUMN sanitized_content TEXT;
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN sanitized_content;
+ALTER TABLE posts DROP COLUMN sanitized_description;
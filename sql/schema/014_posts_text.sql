@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN text_content TEXT;
+ALTER TABLE posts ADD COLUMN summary TEXT;
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN summary;
+ALTER TABLE posts DROP COLUMN text_content;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN extract_full_content BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE posts ADD COLUMN article_content TEXT;
+
+CREATE TABLE article_queue (
+  post_id UUID PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+  queued_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX article_queue_queued_at_idx ON article_queue (queued_at);
+
+-- +goose Down
+DROP TABLE article_queue;
+ALTER TABLE posts DROP COLUMN article_content;
+ALTER TABLE feeds DROP COLUMN extract_full_content;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+ALTER TABLE posts ADD CONSTRAINT posts_feed_id_url_key UNIQUE (feed_id, url);
+ALTER TABLE posts ADD COLUMN cluster_id UUID;
+UPDATE posts SET cluster_id = id;
+ALTER TABLE posts ALTER COLUMN cluster_id SET NOT NULL;
+CREATE INDEX posts_cluster_id_idx ON posts (cluster_id);
+CREATE INDEX posts_created_at_idx ON posts (created_at);
+
+-- +goose Down
+DROP INDEX posts_created_at_idx;
+DROP INDEX posts_cluster_id_idx;
+ALTER TABLE posts DROP COLUMN cluster_id;
+ALTER TABLE posts DROP CONSTRAINT posts_feed_id_url_key;
+-- Posts may now share a URL across feeds. Keep the oldest copy of each so
+-- the old constraint can be restored.
+DELETE FROM posts p USING posts q
+WHERE p.url = q.url AND (p.created_at, p.id) > (q.created_at, q.id);
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN feed_token VARCHAR(64) UNIQUE NOT NULL DEFAULT (
+    encode(sha256(random()::text::bytea), 'hex')
+);
+-- The default only fills in tokens for existing users. New keys and tokens
+-- are generated with crypto/rand in Go, as random() isn't a CSPRNG.
+ALTER TABLE users ALTER COLUMN feed_token DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN api_key DROP DEFAULT;
+
+-- +goose Down
+ALTER TABLE users ALTER COLUMN api_key SET DEFAULT (
+    encode(sha256(random()::text::bytea), 'hex')
+);
+ALTER TABLE users DROP COLUMN feed_token;
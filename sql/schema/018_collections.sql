@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE collections (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  slug TEXT UNIQUE NOT NULL,
+  description TEXT
+);
+
+CREATE TABLE collection_posts (
+  collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  added_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (collection_id, post_id)
+);
+
+CREATE INDEX collection_posts_added_at_idx ON collection_posts (collection_id, added_at DESC);
+
+-- +goose Down
+DROP TABLE collection_posts;
+DROP TABLE collections;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE post_states (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  read BOOLEAN NOT NULL DEFAULT FALSE,
+  starred BOOLEAN NOT NULL DEFAULT FALSE,
+  updated_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX post_states_user_updated_at_idx ON post_states (user_id, updated_at);
+
+-- +goose Down
+DROP TABLE post_states;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE websub_subscriptions (
+  feed_id UUID PRIMARY KEY REFERENCES feeds(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  hub_url TEXT NOT NULL,
+  topic_url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  state TEXT NOT NULL,
+  lease_expires_at TIMESTAMP,
+  last_error TEXT
+);
+
+-- +goose Down
+DROP TABLE websub_subscriptions;
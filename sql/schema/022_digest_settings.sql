@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE digest_settings (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  email TEXT NOT NULL,
+  frequency TEXT NOT NULL,
+  send_hour INTEGER NOT NULL,
+  weekday INTEGER NOT NULL,
+  feed_ids UUID[] NOT NULL DEFAULT '{}',
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  last_sent_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE digest_settings;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE tags (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  UNIQUE (user_id, name)
+);
+
+CREATE TABLE post_tags (
+  tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (tag_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE post_tags;
+DROP TABLE tags;
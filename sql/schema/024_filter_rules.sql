@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE filter_rules (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+  field TEXT NOT NULL,
+  match_type TEXT NOT NULL,
+  pattern TEXT NOT NULL,
+  action TEXT NOT NULL,
+  tag_name TEXT,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+ALTER TABLE post_states ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE post_states DROP COLUMN hidden;
+DROP TABLE filter_rules;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN client_password_hash TEXT;
+ALTER TABLE users ADD COLUMN fever_api_key TEXT UNIQUE;
+ALTER TABLE feeds ADD COLUMN seq BIGSERIAL UNIQUE;
+ALTER TABLE posts ADD COLUMN seq BIGSERIAL UNIQUE;
+
+-- Third-party clients log in by name, so a name can only have one client
+-- password.
+CREATE UNIQUE INDEX users_client_login_name_key ON users (name)
+WHERE client_password_hash IS NOT NULL;
+
+-- +goose Down
+DROP INDEX users_client_login_name_key;
+ALTER TABLE posts DROP COLUMN seq;
+ALTER TABLE feeds DROP COLUMN seq;
+ALTER TABLE users DROP COLUMN fever_api_key;
+ALTER TABLE users DROP COLUMN client_password_hash;
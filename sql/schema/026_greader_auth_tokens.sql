@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN greader_auth_token TEXT UNIQUE;
+ALTER TABLE users ADD COLUMN greader_auth_expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN greader_auth_expires_at;
+ALTER TABLE users DROP COLUMN greader_auth_token;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Renewals send the hub a new secret, but the hub keeps signing with the old
+-- one until it verifies the renewal, so the new one waits here until then.
+ALTER TABLE websub_subscriptions ADD COLUMN pending_secret TEXT;
+
+-- +goose Down
+ALTER TABLE websub_subscriptions DROP COLUMN pending_secret;
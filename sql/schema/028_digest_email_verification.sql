@@ -0,0 +1,10 @@
+-- +goose Up
+-- Digests and notifications only go to addresses the user has confirmed by
+-- following the link we email them. Existing addresses were never
+-- confirmed, so they have to be.
+ALTER TABLE digest_settings ADD COLUMN email_verified_at TIMESTAMP;
+ALTER TABLE digest_settings ADD COLUMN verification_token TEXT UNIQUE;
+
+-- +goose Down
+ALTER TABLE digest_settings DROP COLUMN verification_token;
+ALTER TABLE digest_settings DROP COLUMN email_verified_at;
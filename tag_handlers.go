@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// maxTagNameLength is the longest tag name, in characters, we accept.
+const maxTagNameLength = 64
+
+type Tag struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+}
+
+func databaseTagToTag(tag database.Tag) Tag {
+	return Tag{
+		ID:        tag.ID,
+		CreatedAt: tag.CreatedAt,
+		UpdatedAt: tag.UpdatedAt,
+		Name:      tag.Name,
+	}
+}
+
+// validTagName trims a tag name and reports whether what's left is
+// usable.
+func validTagName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, name != "" && utf8.RuneCountInString(name) <= maxTagNameLength
+}
+
+func (cfg *apiConfig) createTagHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	name, ok := validTagName(params.Name)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag name")
+		return
+	}
+
+	tag, err := cfg.DB.CreateTag(r.Context(), database.CreateTagParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		Name:      name,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			respondWithError(w, http.StatusConflict, "Tag already exists")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create tag")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseTagToTag(tag))
+}
+
+func (cfg *apiConfig) getTagsHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	tags, err := cfg.DB.GetTagsByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get tags")
+		return
+	}
+
+	res := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		res = append(res, databaseTagToTag(tag))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) renameTagHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	tagID, err := uuid.Parse(chi.URLParam(r, "tagID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	name, ok := validTagName(params.Name)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag name")
+		return
+	}
+
+	tag, err := cfg.DB.RenameTag(r.Context(), database.RenameTagParams{
+		ID:     tagID,
+		UserID: user.ID,
+		Name:   name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Tag not found")
+		return
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			respondWithError(w, http.StatusConflict, "Tag already exists")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rename tag")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseTagToTag(tag))
+}
+
+func (cfg *apiConfig) deleteTagHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	tagID, err := uuid.Parse(chi.URLParam(r, "tagID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	err = cfg.DB.DeleteTag(r.Context(), database.DeleteTagParams{
+		ID:     tagID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Tag could not be deleted")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// addPostTagHandler tags a post by tag name, creating the tag if the user
+// doesn't have one by that name yet.
+func (cfg *apiConfig) addPostTagHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	postID, err := uuid.Parse(chi.URLParam(r, "postID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	name, ok := validTagName(params.Name)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag name")
+		return
+	}
+
+	tag, err := cfg.tagPost(r.Context(), user.ID, postID, name)
+	if errors.Is(err, errPostNotFound) {
+		respondWithError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't tag post")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseTagToTag(tag))
+}
+
+// tagPost adds the user's tag called name to a post from one of their
+// followed feeds, creating the tag if it doesn't exist yet. The tag is only
+// created if the post is tagged with it.
+func (cfg *apiConfig) tagPost(ctx context.Context, userID, postID uuid.UUID, name string) (database.Tag, error) {
+	_, err := cfg.DB.GetFollowedPost(ctx, database.GetFollowedPostParams{
+		ID:     postID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Tag{}, errPostNotFound
+	}
+	if err != nil {
+		return database.Tag{}, err
+	}
+
+	tx, err := cfg.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Tag{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	tag, err := qtx.UpsertTag(ctx, database.UpsertTagParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    userID,
+		Name:      name,
+	})
+	if err != nil {
+		return database.Tag{}, err
+	}
+	err = qtx.AddPostTag(ctx, database.AddPostTagParams{
+		TagID:     tag.ID,
+		PostID:    postID,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return database.Tag{}, err
+	}
+	return tag, tx.Commit()
+}
+
+func (cfg *apiConfig) removePostTagHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	postID, err := uuid.Parse(chi.URLParam(r, "postID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	tagID, err := uuid.Parse(chi.URLParam(r, "tagID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	// Look the tag up first so users can only untag with their own tags.
+	tag, err := cfg.DB.GetTagForUser(r.Context(), database.GetTagForUserParams{
+		ID:     tagID,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Tag not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get tag")
+		return
+	}
+
+	err = cfg.DB.RemovePostTag(r.Context(), database.RemovePostTagParams{
+		TagID:  tag.ID,
+		PostID: postID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't untag post")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+func addPostTagRequest(postID uuid.UUID, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/v1/posts/"+postID.String()+"/tags", bytes.NewBufferString(body))
+	return withURLParams(r, "postID", postID.String())
+}
+
+func TestAddPostTag(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New()}
+	post := database.Post{ID: uuid.New(), FeedID: uuid.New()}
+	tag := database.Tag{ID: uuid.New(), UserID: user.ID, Name: "golang"}
+
+	mock.ExpectQuery(query("GetFollowedPost")).
+		WithArgs(post.ID, user.ID).
+		WillReturnRows(modelRows(post))
+	mock.ExpectBegin()
+	mock.ExpectQuery(query("UpsertTag")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, "golang").
+		WillReturnRows(modelRows(tag))
+	mock.ExpectExec(query("AddPostTag")).
+		WithArgs(tag.ID, post.ID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	cfg.addPostTagHandler(w, addPostTagRequest(post.ID, `{"name":" golang "}`), user)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestAddPostTagUnfollowedPost(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New()}
+	postID := uuid.New()
+
+	// No tag may be created for a post the user can't see.
+	mock.ExpectQuery(query("GetFollowedPost")).
+		WithArgs(postID, user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	w := httptest.NewRecorder()
+	cfg.addPostTagHandler(w, addPostTagRequest(postID, `{"name":"golang"}`), user)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNotFound, w.Body)
+	}
+}
+
+func TestAddPostTagRollsBackTag(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New()}
+	post := database.Post{ID: uuid.New(), FeedID: uuid.New()}
+	tag := database.Tag{ID: uuid.New(), UserID: user.ID, Name: "golang"}
+
+	mock.ExpectQuery(query("GetFollowedPost")).
+		WithArgs(post.ID, user.ID).
+		WillReturnRows(modelRows(post))
+	mock.ExpectBegin()
+	mock.ExpectQuery(query("UpsertTag")).
+		WillReturnRows(modelRows(tag))
+	mock.ExpectExec(query("AddPostTag")).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	w := httptest.NewRecorder()
+	cfg.addPostTagHandler(w, addPostTagRequest(post.ID, `{"name":"golang"}`), user)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+}
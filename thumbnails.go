@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type MediaContent struct {
+	URL        string           `xml:"url,attr"`
+	Type       string           `xml:"type,attr"`
+	Medium     string           `xml:"medium,attr"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type MediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+type MediaGroup struct {
+	Contents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+func (m MediaContent) isImage() bool {
+	return m.Medium == "image" || strings.HasPrefix(m.Type, "image/")
+}
+
+// thumbnailURL picks a representative image for item, preferring explicit
+// Media RSS thumbnails, then image media and enclosures, then the episode
+// artwork, and finally the first image in the item's content. Relative URLs
+// are resolved against base.
+func (item RSSItem) thumbnailURL(base string) string {
+	contents := item.MediaContents
+	thumbnails := item.MediaThumbnails
+	for _, group := range item.MediaGroups {
+		contents = append(contents, group.Contents...)
+		thumbnails = append(thumbnails, group.Thumbnails...)
+	}
+	for _, content := range contents {
+		thumbnails = append(thumbnails, content.Thumbnails...)
+	}
+
+	candidates := []string{}
+	for _, thumbnail := range thumbnails {
+		candidates = append(candidates, thumbnail.URL)
+	}
+	for _, content := range contents {
+		if content.isImage() {
+			candidates = append(candidates, content.URL)
+		}
+	}
+	for _, enclosure := range item.Enclosures {
+		if strings.HasPrefix(enclosure.Type, "image/") {
+			candidates = append(candidates, enclosure.URL)
+		}
+	}
+	candidates = append(candidates,
+		item.ITunesImage.Href,
+		firstImageSrc(item.Content),
+		firstImageSrc(item.Description),
+	)
+
+	for _, candidate := range candidates {
+		if u := resolveImageURL(candidate, base); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// firstImageSrc returns the src of the first <img> in an HTML fragment.
+func firstImageSrc(fragment string) string {
+	if !strings.Contains(fragment, "<img") && !strings.Contains(fragment, "<IMG") {
+		return ""
+	}
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "img" {
+				continue
+			}
+			for _, attr := range token.Attr {
+				if attr.Key == "src" && attr.Val != "" {
+					return attr.Val
+				}
+			}
+		}
+	}
+}
+
+// resolveImageURL makes rawURL absolute against base and drops anything that
+// isn't an http(s) URL, such as inline data: images.
+func resolveImageURL(rawURL, base string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if baseURL, err := url.Parse(base); err == nil {
+		u = baseURL.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// timelineFeedLimit is how many posts a user's timeline feed carries.
+const timelineFeedLimit = 50
+
+// timelineCacheControl lets readers and proxies reuse a timeline feed for a
+// few minutes. It's private because the URL is the only thing protecting it.
+const timelineCacheControl = "private, max-age=300"
+
+func (cfg *apiConfig) getTimelineAtomHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.serveTimeline(w, r, "application/atom+xml; charset=utf-8", renderAtom)
+}
+
+func (cfg *apiConfig) getTimelineRSSHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.serveTimeline(w, r, "application/rss+xml; charset=utf-8", renderRSS)
+}
+
+// serveTimeline renders the posts of the user who owns the feed token in
+// the URL. The token stands in for the API key so feed readers that can't
+// send headers can still subscribe.
+func (cfg *apiConfig) serveTimeline(w http.ResponseWriter, r *http.Request, contentType string, render func(outputFeed) ([]byte, error)) {
+	user, err := cfg.DB.GetUserByFeedToken(r.Context(), chi.URLParam(r, "feedToken"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feed")
+		return
+	}
+
+	posts, err := cfg.DB.GetPostsByUser(r.Context(), database.GetPostsByUserParams{
+		UserID: user.ID,
+		Limit:  timelineFeedLimit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get posts")
+		return
+	}
+
+	feed := newOutputFeed(
+		"urn:uuid:"+user.ID.String(),
+		fmt.Sprintf("%s's timeline", user.Name),
+		"Posts from the feeds "+user.Name+" follows",
+		requestURL(r),
+		"",
+		posts,
+	)
+	body, err := render(feed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't render feed")
+		return
+	}
+	serveFeedDocument(w, r, contentType, timelineCacheControl, body, feed.Updated)
+}
+
+// rotateFeedTokenHandler replaces the user's feed token, so any leaked
+// timeline URL stops working.
+func (cfg *apiConfig) rotateFeedTokenHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type FeedTokenResponse struct {
+		FeedToken string `json:"feed_token"`
+	}
+
+	feedToken, err := newSecretToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate feed token")
+		return
+	}
+	user, err = cfg.DB.RotateUserFeedToken(r.Context(), database.RotateUserFeedTokenParams{
+		ID:        user.ID,
+		FeedToken: feedToken,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate feed token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, FeedTokenResponse{FeedToken: user.FeedToken})
+}
+
+// requestURL reconstructs the absolute URL a request was made to, honouring
+// the scheme set by a TLS-terminating proxy.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -15,6 +17,18 @@ type UserResponse struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Name      string    `json:"name"`
 	APIKey    string    `json:"api_key"`
+	FeedToken string    `json:"feed_token"`
+}
+
+func databaseUserToUserResponse(user database.User) UserResponse {
+	return UserResponse{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Name:      user.Name,
+		APIKey:    user.ApiKey,
+		FeedToken: user.FeedToken,
+	}
 }
 
 func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -31,11 +45,24 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
+	apiKey, err := newSecretToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate API key")
+		return
+	}
+	feedToken, err := newSecretToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate feed token")
+		return
+	}
+
 	userParams := database.CreateUserParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Name:      params.Name,
+		ApiKey:    apiKey,
+		FeedToken: feedToken,
 	}
 	user, err := cfg.DB.CreateUser(r.Context(), userParams)
 	if err != nil {
@@ -43,17 +70,19 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	res := UserResponse{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Name:      user.Name,
-		APIKey:    user.ApiKey,
-	}
-
-	respondWithJSON(w, http.StatusCreated, res)
+	respondWithJSON(w, http.StatusCreated, databaseUserToUserResponse(user))
 }
 
 func (cfg *apiConfig) getCurrentUser(w http.ResponseWriter, r *http.Request, user database.User) {
-	respondWithJSON(w, http.StatusOK, user)
+	respondWithJSON(w, http.StatusOK, databaseUserToUserResponse(user))
+}
+
+// newSecretToken returns 32 random bytes from crypto/rand, hex encoded, for
+// use as a bearer credential.
+func newSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+func TestGetCurrentUserHidesClientCredentials(t *testing.T) {
+	cfg, _ := newMockConfig(t)
+	user := database.User{
+		ID:                 uuid.New(),
+		Name:               "ada",
+		ApiKey:             "api-key",
+		FeedToken:          "feed-token",
+		ClientPasswordHash: sql.NullString{String: "$2a$10$hash", Valid: true},
+		FeverApiKey:        sql.NullString{String: "fever-key", Valid: true},
+		GreaderAuthToken:   sql.NullString{String: "greader-token", Valid: true},
+	}
+
+	w := httptest.NewRecorder()
+	cfg.getCurrentUser(w, httptest.NewRequest(http.MethodGet, "/v1/users", nil), user)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"ClientPasswordHash", "FeverApiKey", "GreaderAuthToken", "client_password_hash", "fever_api_key", "greader_auth_token"} {
+		if _, ok := body[key]; ok {
+			t.Errorf("response has %s: %s", key, w.Body)
+		}
+	}
+	for _, secret := range []string{"$2a$10$hash", "fever-key", "greader-token"} {
+		for key, value := range body {
+			if value == secret {
+				t.Errorf("response leaks %s as %s", secret, key)
+			}
+		}
+	}
+	if body["api_key"] != user.ApiKey || body["name"] != user.Name {
+		t.Errorf("body = %s, want the user's name and API key", w.Body)
+	}
+}
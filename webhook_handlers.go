@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// webhookDeliveriesLimit is how many recent deliveries the delivery log
+// returns.
+const webhookDeliveriesLimit = 50
+
+type Webhook struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Url       string     `json:"url"`
+	FeedID    *uuid.UUID `json:"feed_id"`
+	Keyword   *string    `json:"keyword"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	WebhookID      uuid.UUID  `json:"webhook_id"`
+	PostID         *uuid.UUID `json:"post_id"`
+	Event          string     `json:"event"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	ResponseStatus *int32     `json:"response_status"`
+	LastError      *string    `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+func databaseWebhookToWebhook(webhook database.Webhook) Webhook {
+	return Webhook{
+		ID:        webhook.ID,
+		CreatedAt: webhook.CreatedAt,
+		UpdatedAt: webhook.UpdatedAt,
+		Url:       webhook.Url,
+		FeedID:    nullUUIDPtr(webhook.FeedID),
+		Keyword:   nullStringPtr(webhook.Keyword),
+	}
+}
+
+func databaseDeliveryToDelivery(delivery database.WebhookDelivery) WebhookDelivery {
+	return WebhookDelivery{
+		ID:             delivery.ID,
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+		WebhookID:      delivery.WebhookID,
+		PostID:         nullUUIDPtr(delivery.PostID),
+		Event:          delivery.Event,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  nullTimePtr(delivery.NextAttemptAt),
+		ResponseStatus: nullInt32Ptr(delivery.ResponseStatus),
+		LastError:      nullStringPtr(delivery.LastError),
+		DeliveredAt:    nullTimePtr(delivery.DeliveredAt),
+	}
+}
+
+func (cfg *apiConfig) createWebhookHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Url     string     `json:"url"`
+		FeedID  *uuid.UUID `json:"feed_id"`
+		Keyword string     `json:"keyword"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := validateFeedURL(params.Url); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook URL: "+err.Error())
+		return
+	}
+	feedID := uuid.NullUUID{}
+	if params.FeedID != nil {
+		feedID = uuid.NullUUID{UUID: *params.FeedID, Valid: true}
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create webhook secret")
+		return
+	}
+	webhook, err := cfg.DB.CreateWebhook(r.Context(), database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		Url:       params.Url,
+		Secret:    secret,
+		FeedID:    feedID,
+		Keyword:   toNullString(strings.TrimSpace(params.Keyword)),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "violates foreign key constraint") {
+			respondWithError(w, http.StatusNotFound, "Feed not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create webhook")
+		return
+	}
+
+	res := databaseWebhookToWebhook(webhook)
+	res.Secret = webhook.Secret
+	respondWithJSON(w, http.StatusCreated, res)
+}
+
+func (cfg *apiConfig) getWebhooksHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhooks, err := cfg.DB.GetWebhooksByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhooks")
+		return
+	}
+
+	res := make([]Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		res = append(res, databaseWebhookToWebhook(webhook))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) deleteWebhookHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhookID, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	err = cfg.DB.DeleteWebhook(r.Context(), database.DeleteWebhookParams{
+		ID:     webhookID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Webhook could not be deleted")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (cfg *apiConfig) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhook, ok := cfg.webhookFromRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	deliveries, err := cfg.DB.GetWebhookDeliveries(r.Context(), database.GetWebhookDeliveriesParams{
+		WebhookID: webhook.ID,
+		Limit:     webhookDeliveriesLimit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get deliveries")
+		return
+	}
+
+	res := make([]WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		res = append(res, databaseDeliveryToDelivery(delivery))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// testWebhookHandler sends a ping to the webhook straight away and returns
+// the logged delivery, so users can check their receiver and signature
+// verification without waiting for a new post. The ping is tried once and
+// never picked up by the delivery worker.
+func (cfg *apiConfig) testWebhookHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhook, ok := cfg.webhookFromRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	delivery, err := cfg.createWebhookDelivery(r.Context(), webhook, webhookEventPing, nil, false)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create delivery")
+		return
+	}
+	delivery, err = cfg.attemptDelivery(r.Context(), webhook, delivery)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record delivery")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseDeliveryToDelivery(delivery))
+}
+
+// webhookFromRequest loads the webhook named in the URL, writing an error
+// response and returning false unless it belongs to user.
+func (cfg *apiConfig) webhookFromRequest(w http.ResponseWriter, r *http.Request, user database.User) (database.Webhook, bool) {
+	webhookID, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return database.Webhook{}, false
+	}
+	webhook, err := cfg.DB.GetWebhookForUser(r.Context(), database.GetWebhookForUserParams{
+		ID:     webhookID,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook not found")
+		return database.Webhook{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook")
+		return database.Webhook{}, false
+	}
+	return webhook, true
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// Webhook events.
+const (
+	webhookEventPostCreated = "post.created"
+	webhookEventPing        = "ping"
+)
+
+// Delivery statuses. Pending deliveries are retried until they succeed or
+// run out of attempts. A delivery is sending while a worker or the test
+// endpoint has it in hand.
+const (
+	deliveryStatusPending   = "pending"
+	deliveryStatusSending   = "sending"
+	deliveryStatusSucceeded = "succeeded"
+	deliveryStatusFailed    = "failed"
+)
+
+const (
+	// maxWebhookAttempts is how many times we try a delivery before giving
+	// up on it.
+	maxWebhookAttempts = 6
+	// webhookBaseBackoff is the wait after the first failed attempt. It
+	// doubles with each further failure.
+	webhookBaseBackoff = 30 * time.Second
+	webhookTimeout     = 10 * time.Second
+	// webhookBatchSize caps how many deliveries one pass of the worker sends.
+	webhookBatchSize = 50
+	// webhookClaimTimeout is how long a delivery can stay claimed before we
+	// assume the worker sending it died and claim it again.
+	webhookClaimTimeout = 5 * time.Minute
+)
+
+// WebhookPayload is the JSON body POSTed to a webhook.
+type WebhookPayload struct {
+	Event      string    `json:"event"`
+	DeliveryID uuid.UUID `json:"delivery_id"`
+	WebhookID  uuid.UUID `json:"webhook_id"`
+	SentAt     time.Time `json:"sent_at"`
+	Post       *Post     `json:"post,omitempty"`
+}
+
+// queueWebhooks creates a pending delivery of post for every webhook whose
+// owner follows its feed, hasn't hidden the post, and whose filters match.
+func (cfg *apiConfig) queueWebhooks(ctx context.Context, post database.Post, hiddenFor map[uuid.UUID]bool) {
+	webhooks, err := cfg.DB.GetWebhooksForFeed(ctx, post.FeedID)
+	if err != nil {
+		log.Printf("Couldn't get webhooks for post %s: %v", post.Url, err)
+		return
+	}
+	for _, webhook := range webhooks {
+		if hiddenFor[webhook.UserID] || !webhookMatchesPost(webhook, post) {
+			continue
+		}
+		res := databasePostToPost(post, nil, postFormatHTML)
+		_, err := cfg.createWebhookDelivery(ctx, webhook, webhookEventPostCreated, &res, true)
+		if err != nil {
+			log.Printf("Couldn't queue webhook %s for post %s: %v", webhook.ID, post.Url, err)
+		}
+	}
+}
+
+// webhookMatchesPost applies a webhook's keyword filter, a case-insensitive
+// match against the post's title and text.
+func webhookMatchesPost(webhook database.Webhook, post database.Post) bool {
+	if !webhook.Keyword.Valid || webhook.Keyword.String == "" {
+		return true
+	}
+	keyword := strings.ToLower(webhook.Keyword.String)
+	return strings.Contains(strings.ToLower(post.Title), keyword) ||
+		strings.Contains(strings.ToLower(post.TextContent.String), keyword)
+}
+
+// createWebhookDelivery logs a delivery of event to webhook. Queued
+// deliveries are left pending for the worker to send and retry; otherwise
+// the delivery is created as already claimed, for the caller to attempt
+// once itself.
+func (cfg *apiConfig) createWebhookDelivery(ctx context.Context, webhook database.Webhook, event string, post *Post, queued bool) (database.WebhookDelivery, error) {
+	deliveryID := uuid.New()
+	payload := WebhookPayload{
+		Event:      event,
+		DeliveryID: deliveryID,
+		WebhookID:  webhook.ID,
+		SentAt:     time.Now().UTC(),
+		Post:       post,
+	}
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+
+	postID := uuid.NullUUID{}
+	if post != nil {
+		postID = uuid.NullUUID{UUID: post.ID, Valid: true}
+	}
+	status := deliveryStatusSending
+	nextAttemptAt := sql.NullTime{}
+	if queued {
+		status = deliveryStatusPending
+		nextAttemptAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+	return cfg.DB.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+		ID:            deliveryID,
+		CreatedAt:     time.Now().UTC(),
+		UpdatedAt:     time.Now().UTC(),
+		WebhookID:     webhook.ID,
+		PostID:        postID,
+		Event:         event,
+		Payload:       string(dat),
+		Status:        status,
+		NextAttemptAt: nextAttemptAt,
+	})
+}
+
+// startWebhookDelivery sends due webhook deliveries every interval.
+func (cfg *apiConfig) startWebhookDelivery(interval time.Duration) {
+	log.Printf("Delivering webhooks every %s...", interval)
+	ticker := time.NewTicker(interval)
+
+	for ; ; <-ticker.C {
+		now := time.Now().UTC()
+		deliveries, err := cfg.DB.ClaimDueWebhookDeliveries(context.Background(), database.ClaimDueWebhookDeliveriesParams{
+			Now:         now,
+			StaleBefore: now.Add(-webhookClaimTimeout),
+			Limit:       webhookBatchSize,
+		})
+		if err != nil {
+			log.Println("Couldn't get due webhook deliveries", err)
+			continue
+		}
+		for _, delivery := range deliveries {
+			webhook, err := cfg.DB.GetWebhookByID(context.Background(), delivery.WebhookID)
+			if err != nil {
+				log.Printf("Couldn't get webhook %s: %v", delivery.WebhookID, err)
+				continue
+			}
+			if _, err := cfg.attemptDelivery(context.Background(), webhook, delivery); err != nil {
+				log.Printf("Couldn't record webhook delivery %s: %v", delivery.ID, err)
+			}
+		}
+	}
+}
+
+// attemptDelivery sends a delivery once and records the outcome, scheduling
+// a retry with exponential backoff if it failed and has attempts left.
+// Deliveries that were never queued, like test pings, aren't retried.
+func (cfg *apiConfig) attemptDelivery(ctx context.Context, webhook database.Webhook, delivery database.WebhookDelivery) (database.WebhookDelivery, error) {
+	client := &http.Client{
+		Transport: cfg.WebhookTransport,
+		Timeout:   webhookTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	statusCode, sendErr := sendWebhook(ctx, client, webhook.Url, webhook.Secret, delivery.ID, delivery.Event, []byte(delivery.Payload))
+
+	params := database.RecordWebhookAttemptParams{
+		ID:     delivery.ID,
+		Status: deliveryStatusSucceeded,
+	}
+	if statusCode != 0 {
+		params.ResponseStatus = sql.NullInt32{Int32: int32(statusCode), Valid: true}
+	}
+	if sendErr == nil {
+		params.DeliveredAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		return cfg.DB.RecordWebhookAttempt(ctx, params)
+	}
+
+	params.LastError = sql.NullString{String: sendErr.Error(), Valid: true}
+	attempts := delivery.Attempts + 1
+	if !delivery.NextAttemptAt.Valid || attempts >= maxWebhookAttempts {
+		params.Status = deliveryStatusFailed
+	} else {
+		params.Status = deliveryStatusPending
+		params.NextAttemptAt = sql.NullTime{
+			Time:  time.Now().UTC().Add(webhookBackoff(attempts)),
+			Valid: true,
+		}
+	}
+	return cfg.DB.RecordWebhookAttempt(ctx, params)
+}
+
+// webhookBackoff is how long to wait after the given number of failed
+// attempts before trying again.
+func webhookBackoff(attempts int32) time.Duration {
+	return webhookBaseBackoff << (attempts - 1)
+}
+
+// sendWebhook POSTs payload to url, signed with secret. It returns the
+// response status, if there was one, and an error unless the receiver
+// answered with a 2xx.
+//
+// The signature is the hex HMAC-SHA256 of "<timestamp>.<body>", sent as
+// "X-Webhook-Signature: sha256=<hex>" alongside X-Webhook-Timestamp so
+// receivers can reject replays.
+func sendWebhook(ctx context.Context, client *http.Client, url, secret string, deliveryID uuid.UUID, event string, payload []byte) (int, error) {
+	if err := validateFeedURL(url); err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-rss-webhooks")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Delivery", deliveryID.String())
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(secret, timestamp, payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookSecret returns a random signing secret for a new webhook.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// webhookReceiver is a stand-in receiver that verifies signatures the way
+// our docs tell users to, and answers with status.
+func webhookReceiver(t *testing.T, secret string, status int) (*httptest.Server, chan http.Header) {
+	t.Helper()
+	headers := make(chan http.Header, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "."))
+		mac.Write(body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(r.Header.Get("X-Webhook-Signature")), []byte(want)) {
+			t.Errorf("signature = %q, want %q", r.Header.Get("X-Webhook-Signature"), want)
+		}
+		if !json.Valid(body) {
+			t.Errorf("body isn't JSON: %s", body)
+		}
+		headers <- r.Header.Clone()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, headers
+}
+
+func TestSendWebhook(t *testing.T) {
+	server, headers := webhookReceiver(t, "s3cret", http.StatusNoContent)
+	deliveryID := uuid.New()
+
+	status, err := sendWebhook(context.Background(), server.Client(), server.URL, "s3cret", deliveryID, webhookEventPing, []byte(`{"event":"ping"}`))
+	if err != nil {
+		t.Fatalf("sendWebhook: %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", status, http.StatusNoContent)
+	}
+	header := <-headers
+	if got := header.Get("X-Webhook-Event"); got != webhookEventPing {
+		t.Errorf("X-Webhook-Event = %q", got)
+	}
+	if got := header.Get("X-Webhook-Delivery"); got != deliveryID.String() {
+		t.Errorf("X-Webhook-Delivery = %q", got)
+	}
+}
+
+func TestSendWebhookRejected(t *testing.T) {
+	server, _ := webhookReceiver(t, "s3cret", http.StatusInternalServerError)
+
+	status, err := sendWebhook(context.Background(), server.Client(), server.URL, "s3cret", uuid.New(), webhookEventPing, []byte(`{}`))
+	if err == nil {
+		t.Fatal("sendWebhook succeeded against a failing receiver")
+	}
+	if status != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", status, http.StatusInternalServerError)
+	}
+}
+
+func TestAttemptDelivery(t *testing.T) {
+	now := time.Now().UTC()
+	queued := sql.NullTime{Time: now, Valid: true}
+	tests := []struct {
+		name          string
+		receiver      int
+		attempts      int32
+		nextAttemptAt sql.NullTime
+		wantStatus    string
+		wantRetryIn   time.Duration
+	}{
+		{"success", http.StatusOK, 0, queued, deliveryStatusSucceeded, 0},
+		{"first failure", http.StatusBadGateway, 0, queued, deliveryStatusPending, 30 * time.Second},
+		{"third failure", http.StatusBadGateway, 2, queued, deliveryStatusPending, 2 * time.Minute},
+		{"fifth failure", http.StatusBadGateway, 4, queued, deliveryStatusPending, 8 * time.Minute},
+		{"last attempt", http.StatusBadGateway, maxWebhookAttempts - 1, queued, deliveryStatusFailed, 0},
+		{"test ping", http.StatusBadGateway, 0, sql.NullTime{}, deliveryStatusFailed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			server, _ := webhookReceiver(t, "s3cret", tt.receiver)
+			webhook := database.Webhook{ID: uuid.New(), Url: server.URL, Secret: "s3cret"}
+			delivery := database.WebhookDelivery{
+				ID:            uuid.New(),
+				WebhookID:     webhook.ID,
+				Event:         webhookEventPostCreated,
+				Payload:       `{"event":"post.created"}`,
+				Status:        deliveryStatusSending,
+				Attempts:      tt.attempts,
+				NextAttemptAt: tt.nextAttemptAt,
+			}
+
+			var lastError, nextAttempt, deliveredAt interface{} = isNull{}, isNull{}, isNull{}
+			if tt.wantStatus == deliveryStatusSucceeded {
+				deliveredAt = timeNear{time.Now().UTC()}
+			} else {
+				lastError = sqlmock.AnyArg()
+			}
+			if tt.wantRetryIn != 0 {
+				nextAttempt = timeNear{time.Now().UTC().Add(tt.wantRetryIn)}
+			}
+			recorded := delivery
+			recorded.Status = tt.wantStatus
+			recorded.Attempts++
+			mock.ExpectQuery(query("RecordWebhookAttempt")).
+				WithArgs(delivery.ID, tt.wantStatus, int64(tt.receiver), lastError, nextAttempt, deliveredAt).
+				WillReturnRows(modelRows(recorded))
+
+			got, err := cfg.attemptDelivery(context.Background(), webhook, delivery)
+			if err != nil {
+				t.Fatalf("attemptDelivery: %v", err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAttemptDeliveryIgnoresFeedAllowlist(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+
+	// Loopback is allowlisted for feeds, the way a self-hosted feed would
+	// be, but webhooks get a transport without the allowlist.
+	allowed, err := parseAllowedNetworks("127.0.0.0/8,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.FeedTransport = newFeedTransport(&addressGuard{allowed: allowed})
+	cfg.WebhookTransport = newFeedTransport(&addressGuard{})
+
+	webhook := database.Webhook{ID: uuid.New(), Url: server.URL, Secret: "s3cret"}
+	delivery := database.WebhookDelivery{
+		ID:        uuid.New(),
+		WebhookID: webhook.ID,
+		Event:     webhookEventPing,
+		Payload:   `{"event":"ping"}`,
+		Status:    deliveryStatusSending,
+	}
+	var lastError string
+	recorded := delivery
+	recorded.Status = deliveryStatusFailed
+	mock.ExpectQuery(query("RecordWebhookAttempt")).
+		WithArgs(delivery.ID, deliveryStatusFailed, isNull{}, captureString{&lastError}, isNull{}, isNull{}).
+		WillReturnRows(modelRows(recorded))
+
+	if _, err := cfg.attemptDelivery(context.Background(), webhook, delivery); err != nil {
+		t.Fatalf("attemptDelivery: %v", err)
+	}
+	if !strings.Contains(lastError, "is not allowed") {
+		t.Errorf("last error = %q, want the guard's refusal", lastError)
+	}
+	select {
+	case <-received:
+		t.Error("webhook was delivered to an allowlisted address")
+	default:
+	}
+}
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New()}
+	webhook := database.Webhook{ID: uuid.New(), UserID: user.ID, Url: "https://example.com/hook", Secret: "s3cret"}
+	now := time.Now().UTC().Truncate(time.Second)
+	deliveries := []interface{}{
+		database.WebhookDelivery{
+			ID:             uuid.New(),
+			CreatedAt:      now,
+			UpdatedAt:      now,
+			WebhookID:      webhook.ID,
+			Event:          webhookEventPostCreated,
+			Payload:        "{}",
+			Status:         deliveryStatusPending,
+			Attempts:       2,
+			NextAttemptAt:  sql.NullTime{Time: now.Add(time.Minute), Valid: true},
+			ResponseStatus: sql.NullInt32{Int32: http.StatusBadGateway, Valid: true},
+			LastError:      sql.NullString{String: "unexpected status 502 Bad Gateway", Valid: true},
+		},
+		database.WebhookDelivery{
+			ID:             uuid.New(),
+			CreatedAt:      now.Add(-time.Hour),
+			UpdatedAt:      now.Add(-time.Hour),
+			WebhookID:      webhook.ID,
+			Event:          webhookEventPing,
+			Payload:        "{}",
+			Status:         deliveryStatusSucceeded,
+			Attempts:       1,
+			ResponseStatus: sql.NullInt32{Int32: http.StatusOK, Valid: true},
+			DeliveredAt:    sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+		},
+	}
+
+	mock.ExpectQuery(query("GetWebhookForUser")).
+		WithArgs(webhook.ID, user.ID).
+		WillReturnRows(modelRows(webhook))
+	mock.ExpectQuery(query("GetWebhookDeliveries")).
+		WithArgs(webhook.ID, webhookDeliveriesLimit).
+		WillReturnRows(modelRows(deliveries...))
+
+	req := withURLParams(httptest.NewRequest(http.MethodGet, "/v1/webhooks/"+webhook.ID.String()+"/deliveries", nil), "webhookID", webhook.ID.String())
+	w := httptest.NewRecorder()
+	cfg.getWebhookDeliveriesHandler(w, req, user)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	got := []WebhookDelivery{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d deliveries, want 2", len(got))
+	}
+	if got[0].Status != deliveryStatusPending || got[0].Attempts != 2 || got[0].LastError == nil || got[0].NextAttemptAt == nil {
+		t.Errorf("pending delivery = %+v", got[0])
+	}
+	if got[1].Status != deliveryStatusSucceeded || got[1].DeliveredAt == nil || *got[1].ResponseStatus != http.StatusOK {
+		t.Errorf("succeeded delivery = %+v", got[1])
+	}
+}
+
+func TestTestWebhookHandlerSendsOnce(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	server, headers := webhookReceiver(t, "s3cret", http.StatusServiceUnavailable)
+	user := database.User{ID: uuid.New()}
+	webhook := database.Webhook{ID: uuid.New(), UserID: user.ID, Url: server.URL, Secret: "s3cret"}
+	delivery := database.WebhookDelivery{
+		ID:        uuid.New(),
+		WebhookID: webhook.ID,
+		Event:     webhookEventPing,
+		Payload:   `{"event":"ping"}`,
+		Status:    deliveryStatusSending,
+	}
+	failed := delivery
+	failed.Status = deliveryStatusFailed
+	failed.Attempts = 1
+
+	mock.ExpectQuery(query("GetWebhookForUser")).
+		WithArgs(webhook.ID, user.ID).
+		WillReturnRows(modelRows(webhook))
+	// The ping is created already claimed and without a next attempt, so
+	// the delivery worker never picks it up.
+	mock.ExpectQuery(query("CreateWebhookDelivery")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), webhook.ID, isNull{}, webhookEventPing, sqlmock.AnyArg(), deliveryStatusSending, isNull{}).
+		WillReturnRows(modelRows(delivery))
+	mock.ExpectQuery(query("RecordWebhookAttempt")).
+		WithArgs(delivery.ID, deliveryStatusFailed, int64(http.StatusServiceUnavailable), sqlmock.AnyArg(), isNull{}, isNull{}).
+		WillReturnRows(modelRows(failed))
+
+	req := withURLParams(httptest.NewRequest(http.MethodPost, "/v1/webhooks/"+webhook.ID.String()+"/test", nil), "webhookID", webhook.ID.String())
+	w := httptest.NewRecorder()
+	cfg.testWebhookHandler(w, req, user)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if len(headers) != 1 {
+		t.Errorf("receiver got %d requests, want 1", len(headers))
+	}
+	got := WebhookDelivery{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != deliveryStatusFailed {
+		t.Errorf("status = %q, want %q", got.Status, deliveryStatusFailed)
+	}
+}
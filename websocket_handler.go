@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+const (
+	// wsPingInterval is how often we ping the client. If no pong or other
+	// message arrives within wsPongTimeout the connection is dropped, and
+	// the client is expected to reconnect and resume.
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsWriteTimeout = 10 * time.Second
+	wsMaxMessage   = 64 << 10
+)
+
+// Message types sent by clients.
+const (
+	wsTypeSubscribe = "subscribe"
+	wsTypeSetState  = "set_state"
+	wsTypePing      = "ping"
+)
+
+// Message types sent by the server.
+const (
+	wsTypePost         = "post"
+	wsTypeState        = "state"
+	wsTypePong         = "pong"
+	wsTypeError        = "error"
+	wsTypeNotification = "notification"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Connections are authenticated by API key, not cookies, so there's
+	// no cross-site request to guard against.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsClientMessage is a message from the client. Which fields are used
+// depends on Type.
+type wsClientMessage struct {
+	Type    string      `json:"type"`
+	FeedIDs []uuid.UUID `json:"feed_ids"`
+	PostID  uuid.UUID   `json:"post_id"`
+	Read    *bool       `json:"read"`
+	Starred *bool       `json:"starred"`
+	Hidden  *bool       `json:"hidden"`
+}
+
+type wsServerMessage struct {
+	Type  string     `json:"type"`
+	Post  *Post      `json:"post,omitempty"`
+	State *PostState `json:"state,omitempty"`
+	// RuleID is the filter rule behind a notification.
+	RuleID *uuid.UUID `json:"rule_id,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// websocketHandler carries new posts from the user's followed feeds and
+// changes to their read and starred state, in both directions. Clients can
+// narrow posts to some feeds with a subscribe message.
+//
+// To resume after a dropped connection, clients pass the last post ID they
+// saw as last_post_id and the updated_at of the last state they saw as
+// states_since; everything after those is sent before live events.
+func (cfg *apiConfig) websocketHandler(w http.ResponseWriter, r *http.Request, user database.User) {
+	query := r.URL.Query()
+	var anchor *database.Post
+	if s := query.Get("last_post_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid last_post_id")
+			return
+		}
+		post, ok := cfg.replayAnchor(w, r, id, "last_post_id")
+		if !ok {
+			return
+		}
+		anchor = &post
+	}
+	var statesSince time.Time
+	if s := query.Get("states_since"); s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid states_since")
+			return
+		}
+		statesSince = t.UTC()
+	}
+
+	followed, err := cfg.followedFeedIDs(r, user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feed follows")
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response.
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := cfg.Events.subscribe()
+	defer unsubscribe()
+
+	send := func(msg wsServerMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(msg)
+	}
+	sendPost := func(post database.Post) error {
+		res := databasePostToPost(post, nil, postFormatHTML)
+		return send(wsServerMessage{Type: wsTypePost, Post: &res})
+	}
+	sendState := func(state database.PostState) error {
+		res := databasePostStateToPostState(state)
+		return send(wsServerMessage{Type: wsTypeState, State: &res})
+	}
+
+	sent := map[uuid.UUID]bool{}
+	if anchor != nil {
+		missed, err := cfg.DB.GetPostsByUserSince(r.Context(), database.GetPostsByUserSinceParams{
+			UserID:         user.ID,
+			AfterCreatedAt: anchor.CreatedAt,
+			AfterID:        anchor.ID,
+			Limit:          postStreamReplayLimit,
+		})
+		if err != nil {
+			log.Printf("Couldn't replay posts for %s: %v", user.Name, err)
+			return
+		}
+		for _, post := range missed {
+			if err := sendPost(post); err != nil {
+				return
+			}
+			sent[post.ID] = true
+		}
+	}
+	if !statesSince.IsZero() {
+		states, err := cfg.DB.GetPostStatesSince(r.Context(), database.GetPostStatesSinceParams{
+			UserID:    user.ID,
+			UpdatedAt: statesSince,
+			Limit:     postStatesLimit,
+		})
+		if err != nil {
+			log.Printf("Couldn't replay post states for %s: %v", user.Name, err)
+			return
+		}
+		for _, state := range states {
+			if err := sendState(state); err != nil {
+				return
+			}
+		}
+	}
+
+	// Reads happen on their own goroutine; everything else, including all
+	// writes, happens on this one.
+	incoming := make(chan wsClientMessage)
+	readErr := make(chan error, 1)
+	go func() {
+		conn.SetReadLimit(wsMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		for {
+			var msg wsClientMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				readErr <- err
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			select {
+			case incoming <- msg:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	var feedFilter map[uuid.UUID]bool
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-readErr:
+			return
+		case <-ping.C:
+			if refreshed, err := cfg.followedFeedIDs(r, user); err == nil {
+				followed = refreshed
+			}
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		case msg := <-incoming:
+			switch msg.Type {
+			case wsTypeSubscribe:
+				feedFilter = nil
+				if len(msg.FeedIDs) > 0 {
+					feedFilter = make(map[uuid.UUID]bool, len(msg.FeedIDs))
+					for _, id := range msg.FeedIDs {
+						feedFilter[id] = true
+					}
+				}
+			case wsTypeSetState:
+				// The change comes back to this connection through the
+				// event bus like any other.
+				_, setErr := cfg.setPostState(r.Context(), user.ID, msg.PostID, postStateChange{
+					Read:    msg.Read,
+					Starred: msg.Starred,
+					Hidden:  msg.Hidden,
+				})
+				if errors.Is(setErr, errPostNotFound) {
+					err = send(wsServerMessage{Type: wsTypeError, Error: "Post not found"})
+				} else if setErr != nil {
+					log.Printf("Couldn't update post state for %s: %v", user.Name, setErr)
+					err = send(wsServerMessage{Type: wsTypeError, Error: "Couldn't update post state"})
+				}
+			case wsTypePing:
+				err = send(wsServerMessage{Type: wsTypePong})
+			default:
+				err = send(wsServerMessage{Type: wsTypeError, Error: "Unknown message type " + msg.Type})
+			}
+		case e, ok := <-events:
+			if !ok {
+				// We fell behind; close so the client reconnects and
+				// resumes from the database.
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			switch {
+			case e.Post != nil:
+				if !followed[e.Post.FeedID] || e.HiddenFor[user.ID] || sent[e.Post.ID] {
+					continue
+				}
+				if feedFilter != nil && !feedFilter[e.Post.FeedID] {
+					continue
+				}
+				err = sendPost(*e.Post)
+			case e.State != nil && e.State.UserID == user.ID:
+				err = sendState(*e.State)
+			case e.Notification != nil && e.Notification.UserID == user.ID:
+				res := databasePostToPost(e.Notification.Post, nil, postFormatHTML)
+				err = send(wsServerMessage{Type: wsTypeNotification, Post: &res, RuleID: &e.Notification.RuleID})
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// WebSub subscription states.
+const (
+	websubStatePending = "pending"
+	websubStateActive  = "active"
+	websubStateDenied  = "denied"
+	websubStateFailed  = "failed"
+)
+
+const (
+	// websubLease is the lease we ask hubs for. Hubs may grant a different
+	// one when they verify the subscription.
+	websubLease = 10 * 24 * time.Hour
+	// websubRenewBefore is how long before a lease runs out we renew it.
+	websubRenewBefore = 24 * time.Hour
+	// websubRetryAfter is how long a subscription can sit unverified or
+	// failed before we try again.
+	websubRetryAfter = time.Hour
+	websubRenewBatch = 50
+	// websubMinRefetchInterval is how recently a feed may have been fetched
+	// for an unsigned push to still queue another fetch.
+	websubMinRefetchInterval = 5 * time.Minute
+)
+
+// websubHashes are the signature algorithms hubs may use in
+// X-Hub-Signature.
+var websubHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// ensureWebSub subscribes to the feed's hub if it advertises one and we
+// don't already have a live subscription for it. It does nothing unless
+// PUBLIC_BASE_URL is set, since hubs need a callback they can reach.
+func (cfg *apiConfig) ensureWebSub(ctx context.Context, feed database.Feed, feedData *RSSFeed, result fetchResult) {
+	if cfg.PublicBaseURL == "" {
+		return
+	}
+	hubURL, topicURL := result.HubURL, result.SelfURL
+	for _, link := range feedData.Channel.AtomLinks {
+		if link.Rel == "hub" && hubURL == "" {
+			hubURL = resolveWebSubLink(link.Href, feed.Url)
+		}
+		if link.Rel == "self" && topicURL == "" {
+			topicURL = resolveWebSubLink(link.Href, feed.Url)
+		}
+	}
+	if hubURL == "" {
+		return
+	}
+	if topicURL == "" {
+		topicURL = feed.Url
+	}
+
+	sub, err := cfg.DB.GetWebSubSubscription(ctx, feed.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Couldn't get WebSub subscription for feed %s: %v", feed.Name, err)
+		return
+	}
+	if err == nil && sub.HubUrl == hubURL && sub.TopicUrl == topicURL {
+		// Renewals and retries are left to startWebSubRenewal.
+		return
+	}
+
+	if err := cfg.subscribeWebSub(ctx, feed.ID, hubURL, topicURL); err != nil {
+		log.Printf("Couldn't subscribe to hub %s for feed %s: %v", hubURL, feed.Name, err)
+	}
+}
+
+// resolveWebSubLink makes an atom:link href absolute against the feed URL.
+// Hubs match topics byte for byte, so unlike post links it isn't otherwise
+// normalized.
+func resolveWebSubLink(href, base string) string {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if baseURL, err := url.Parse(base); err == nil {
+		u = baseURL.ResolveReference(u)
+	}
+	return u.String()
+}
+
+// subscribeWebSub asks a hub to push topic to our callback for feedID. The
+// subscription stays pending until the hub verifies it.
+//
+// Only https hubs are given a secret, since the spec forbids sending one in
+// the clear. Pushes from other hubs can't be authenticated, so they're
+// treated as a hint to fetch the feed ourselves.
+func (cfg *apiConfig) subscribeWebSub(ctx context.Context, feedID uuid.UUID, hubURL, topicURL string) error {
+	form, secret, err := cfg.websubSubscribeForm(feedID, hubURL, topicURL)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.DB.UpsertWebSubSubscription(ctx, database.UpsertWebSubSubscriptionParams{
+		FeedID:    feedID,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		HubUrl:    hubURL,
+		TopicUrl:  topicURL,
+		Secret:    secret,
+		State:     websubStatePending,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cfg.sendWebSubRequest(ctx, hubURL, form)
+	if err != nil {
+		stateErr := cfg.DB.SetWebSubSubscriptionState(ctx, database.SetWebSubSubscriptionStateParams{
+			FeedID:    feedID,
+			State:     websubStateFailed,
+			LastError: sql.NullString{String: err.Error(), Valid: true},
+		})
+		if stateErr != nil {
+			log.Printf("Couldn't record WebSub failure for feed %s: %v", feedID, stateErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// renewWebSub extends the lease of an active subscription. The hub keeps
+// pushing under the current lease and secret until it verifies the renewal,
+// so the subscription stays active and the new secret is held as pending
+// until websubVerifyHandler swaps it in. A failed renewal is recorded but
+// leaves the subscription alone, since its lease hasn't run out yet.
+func (cfg *apiConfig) renewWebSub(ctx context.Context, sub database.WebsubSubscription) error {
+	form, secret, err := cfg.websubSubscribeForm(sub.FeedID, sub.HubUrl, sub.TopicUrl)
+	if err != nil {
+		return err
+	}
+	err = cfg.DB.SetWebSubPendingSecret(ctx, database.SetWebSubPendingSecretParams{
+		FeedID:        sub.FeedID,
+		PendingSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cfg.sendWebSubRequest(ctx, sub.HubUrl, form)
+	if err != nil {
+		stateErr := cfg.DB.SetWebSubSubscriptionState(ctx, database.SetWebSubSubscriptionStateParams{
+			FeedID:    sub.FeedID,
+			State:     sub.State,
+			LastError: sql.NullString{String: err.Error(), Valid: true},
+		})
+		if stateErr != nil {
+			log.Printf("Couldn't record WebSub failure for feed %s: %v", sub.FeedID, stateErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// websubSubscribeForm builds a subscription request for feedID, along with
+// the secret it gives the hub, which is empty for hubs that aren't https.
+func (cfg *apiConfig) websubSubscribeForm(feedID uuid.UUID, hubURL, topicURL string) (url.Values, string, error) {
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topicURL},
+		"hub.callback":      {cfg.websubCallbackURL(feedID)},
+		"hub.lease_seconds": {strconv.Itoa(int(websubLease.Seconds()))},
+	}
+	secret := ""
+	if u, err := url.Parse(hubURL); err == nil && u.Scheme == "https" {
+		s, err := newWebhookSecret()
+		if err != nil {
+			return nil, "", err
+		}
+		secret = s
+		form.Set("hub.secret", secret)
+	}
+	return form, secret, nil
+}
+
+func (cfg *apiConfig) sendWebSubRequest(ctx context.Context, hubURL string, form url.Values) error {
+	if err := validateFeedURL(hubURL); err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: cfg.FeedTransport,
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("hub responded %s", resp.Status)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) websubCallbackURL(feedID uuid.UUID) string {
+	return strings.TrimRight(cfg.PublicBaseURL, "/") + "/v1/websub/" + feedID.String()
+}
+
+// startWebSubRenewal renews leases that are about to run out and retries
+// subscriptions the hub never verified.
+func (cfg *apiConfig) startWebSubRenewal(interval time.Duration) {
+	log.Printf("Renewing WebSub subscriptions every %s...", interval)
+	ticker := time.NewTicker(interval)
+
+	for ; ; <-ticker.C {
+		cfg.renewWebSubSubscriptions(context.Background())
+	}
+}
+
+// renewWebSubSubscriptions resubscribes one batch of subscriptions that are
+// due for renewal or a retry.
+func (cfg *apiConfig) renewWebSubSubscriptions(ctx context.Context) {
+	subs, err := cfg.DB.GetWebSubSubscriptionsToRenew(ctx, database.GetWebSubSubscriptionsToRenewParams{
+		RenewBefore: sql.NullTime{Time: time.Now().UTC().Add(websubRenewBefore), Valid: true},
+		RetryBefore: time.Now().UTC().Add(-websubRetryAfter),
+		Limit:       websubRenewBatch,
+	})
+	if err != nil {
+		log.Println("Couldn't get WebSub subscriptions to renew", err)
+		return
+	}
+	for _, sub := range subs {
+		var err error
+		if sub.State == websubStateActive {
+			err = cfg.renewWebSub(ctx, sub)
+		} else {
+			err = cfg.subscribeWebSub(ctx, sub.FeedID, sub.HubUrl, sub.TopicUrl)
+		}
+		if err != nil {
+			log.Printf("Couldn't renew WebSub subscription for feed %s: %v", sub.FeedID, err)
+		}
+	}
+}
+
+// websubVerifyHandler answers a hub's verification of intent, confirming
+// only subscriptions we asked for. Confirming a renewal switches to the
+// secret sent with it.
+func (cfg *apiConfig) websubVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := cfg.websubFromRequest(w, r, http.StatusNotFound)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("hub.topic") != sub.TopicUrl {
+		respondWithError(w, http.StatusNotFound, "Unknown topic")
+		return
+	}
+
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		if sub.State != websubStatePending && sub.State != websubStateActive {
+			respondWithError(w, http.StatusNotFound, "No pending subscription")
+			return
+		}
+		lease := websubLease
+		if seconds, err := strconv.Atoi(query.Get("hub.lease_seconds")); err == nil && seconds > 0 {
+			lease = time.Duration(seconds) * time.Second
+		}
+		err := cfg.DB.ActivateWebSubSubscription(r.Context(), database.ActivateWebSubSubscriptionParams{
+			FeedID:         sub.FeedID,
+			LeaseExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(lease), Valid: true},
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't activate subscription")
+			return
+		}
+	case "denied":
+		err := cfg.DB.SetWebSubSubscriptionState(r.Context(), database.SetWebSubSubscriptionStateParams{
+			FeedID:    sub.FeedID,
+			State:     websubStateDenied,
+			LastError: toNullString(query.Get("hub.reason")),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't record denial")
+			return
+		}
+	default:
+		// We never unsubscribe, so any other request isn't ours.
+		respondWithError(w, http.StatusNotFound, "Unexpected mode")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(query.Get("hub.challenge")))
+}
+
+// websubPushHandler receives content pushed by a hub and ingests it like a
+// polled fetch. Content with a missing or bad signature is acknowledged but
+// ignored, as the spec requires. Hubs we gave no secret can't sign, so their
+// pushes only ask the scraper to fetch the feed. Hubs are only told the
+// subscription is gone when we have none or the hub denied it; pushes that
+// race a pending renewal or retry are still accepted.
+func (cfg *apiConfig) websubPushHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := cfg.websubFromRequest(w, r, http.StatusGone)
+	if !ok {
+		return
+	}
+	if sub.State == websubStateDenied {
+		respondWithError(w, http.StatusGone, "Subscription was denied")
+		return
+	}
+
+	body, err := io.ReadAll(&maxBytesReader{r: r.Body, max: cfg.MaxFeedBytes})
+	if err != nil {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Couldn't read content")
+		return
+	}
+	defer r.Body.Close()
+	w.WriteHeader(http.StatusAccepted)
+
+	if sub.Secret == "" {
+		cfg.requestWebSubRefetch(r.Context(), sub.FeedID)
+		return
+	}
+
+	signature := r.Header.Get("X-Hub-Signature")
+	if !validHubSignature(signature, sub.Secret, body) &&
+		!(sub.PendingSecret.Valid && validHubSignature(signature, sub.PendingSecret.String, body)) {
+		log.Printf("Ignoring WebSub push for feed %s with a bad signature", sub.FeedID)
+		return
+	}
+	go cfg.ingestWebSubPush(sub.FeedID, body, r.Header.Get("Content-Type"))
+}
+
+// ingestWebSubPush ingests the content of an authenticated push.
+func (cfg *apiConfig) ingestWebSubPush(feedID uuid.UUID, body []byte, contentType string) {
+	ctx := context.Background()
+	feed, err := cfg.DB.GetFeedByID(ctx, feedID)
+	if err != nil {
+		log.Printf("Couldn't get feed %s for WebSub push: %v", feedID, err)
+		return
+	}
+	decoder, err := newFeedDecoder(bytes.NewReader(body), contentType)
+	if err != nil {
+		log.Printf("Couldn't decode WebSub push for feed %s: %v", feed.Name, err)
+		return
+	}
+	var feedData RSSFeed
+	if err := decoder.Decode(&feedData); err != nil {
+		log.Printf("Couldn't parse WebSub push for feed %s: %v", feed.Name, err)
+		return
+	}
+	cfg.ingestFeed(ctx, feed, &feedData)
+}
+
+// requestWebSubRefetch queues a feed whose hub pushed content we couldn't
+// authenticate for the scraper's next run, rather than trusting the push.
+// Anyone can send those pushes, so feeds fetched within
+// websubMinRefetchInterval are left alone.
+func (cfg *apiConfig) requestWebSubRefetch(ctx context.Context, feedID uuid.UUID) {
+	_, err := cfg.DB.RequestFeedRefetch(ctx, database.RequestFeedRefetchParams{
+		ID:            feedID,
+		FetchedBefore: sql.NullTime{Time: time.Now().UTC().Add(-websubMinRefetchInterval), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't queue feed %s for a WebSub refetch: %v", feedID, err)
+	}
+}
+
+// websubFromRequest looks up the subscription a callback is for, answering
+// missingStatus when there isn't one.
+func (cfg *apiConfig) websubFromRequest(w http.ResponseWriter, r *http.Request, missingStatus int) (database.WebsubSubscription, bool) {
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid feed ID")
+		return database.WebsubSubscription{}, false
+	}
+	sub, err := cfg.DB.GetWebSubSubscription(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, missingStatus, "Subscription not found")
+		return database.WebsubSubscription{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription")
+		return database.WebsubSubscription{}, false
+	}
+	return sub, true
+}
+
+// validHubSignature checks an X-Hub-Signature header of the form
+// "<algorithm>=<hex HMAC of body>".
+func validHubSignature(header, secret string, body []byte) bool {
+	algorithm, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	newHash, ok := websubHashes[strings.ToLower(algorithm)]
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// parseLinkHeader returns the targets of HTTP Link header values keyed by
+// rel, resolved against base. The first link for each rel wins.
+func parseLinkHeader(values []string, base *url.URL) map[string]string {
+	links := map[string]string{}
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			if u, err := url.Parse(target); err == nil && base != nil {
+				target = base.ResolveReference(u).String()
+			}
+			for _, param := range parts[1:] {
+				key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(val), `"`)) {
+					rel = strings.ToLower(rel)
+					if _, exists := links[rel]; !exists {
+						links[rel] = target
+					}
+				}
+			}
+		}
+	}
+	return links
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/m-rstewart/go-rss/internal/database"
+)
+
+// websubHub is a stand-in hub that records the subscription requests it
+// receives.
+func websubHub(t *testing.T, newServer func(http.Handler) *httptest.Server) (*httptest.Server, chan url.Values) {
+	t.Helper()
+	forms := make(chan url.Values, 10)
+	server := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		forms <- r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server, forms
+}
+
+func TestResolveWebSubLink(t *testing.T) {
+	tests := []struct {
+		href string
+		want string
+	}{
+		{"https://hub.example/", "https://hub.example/"},
+		{"/feed.xml", "https://blog.example/feed.xml"},
+		// Hubs compare topics byte for byte, so nothing a canonical post
+		// URL would drop may be touched.
+		{"https://Blog.example/feed/?utm_source=rss#top", "https://Blog.example/feed/?utm_source=rss#top"},
+		{"feed?b=2&a=1", "https://blog.example/posts/feed?b=2&a=1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := resolveWebSubLink(tt.href, "https://blog.example/posts/"); got != tt.want {
+			t.Errorf("resolveWebSubLink(%q) = %q, want %q", tt.href, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureWebSub(t *testing.T) {
+	tests := []struct {
+		name       string
+		newServer  func(http.Handler) *httptest.Server
+		wantSecret bool
+	}{
+		{"https hub", httptest.NewTLSServer, true},
+		{"http hub", httptest.NewServer, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub, forms := websubHub(t, tt.newServer)
+			cfg, mock := newMockConfig(t)
+			cfg.FeedTransport = hub.Client().Transport
+			cfg.PublicBaseURL = "https://reader.example/"
+
+			var feedData RSSFeed
+			err := xml.Unmarshal([]byte(`<rss xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+<atom:link rel="hub" href="`+hub.URL+`/hub"/>
+<atom:link rel="self" href="/feed/?utm_source=rss"/>
+</channel></rss>`), &feedData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			feed := database.Feed{ID: uuid.New(), Name: "Blog", Url: "https://blog.example/feed/"}
+			topic := "https://blog.example/feed/?utm_source=rss"
+
+			var secret interface{} = sqlmock.AnyArg()
+			if !tt.wantSecret {
+				secret = ""
+			}
+			mock.ExpectQuery(query("GetWebSubSubscription")).
+				WithArgs(feed.ID).
+				WillReturnRows(sqlmock.NewRows(nil))
+			mock.ExpectQuery(query("UpsertWebSubSubscription")).
+				WithArgs(feed.ID, timeNear{time.Now()}, timeNear{time.Now()}, hub.URL+"/hub", topic, secret, websubStatePending).
+				WillReturnRows(modelRows(database.WebsubSubscription{FeedID: feed.ID}))
+
+			cfg.ensureWebSub(context.Background(), feed, &feedData, fetchResult{})
+
+			form := <-forms
+			if got := form.Get("hub.mode"); got != "subscribe" {
+				t.Errorf("hub.mode = %q, want subscribe", got)
+			}
+			if got := form.Get("hub.topic"); got != topic {
+				t.Errorf("hub.topic = %q, want %q", got, topic)
+			}
+			if got, want := form.Get("hub.callback"), "https://reader.example/v1/websub/"+feed.ID.String(); got != want {
+				t.Errorf("hub.callback = %q, want %q", got, want)
+			}
+			if _, ok := form["hub.secret"]; ok != tt.wantSecret {
+				t.Errorf("hub.secret sent = %v, want %v", ok, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestWebSubVerifyHandler(t *testing.T) {
+	sub := database.WebsubSubscription{
+		FeedID:   uuid.New(),
+		HubUrl:   "https://hub.example/",
+		TopicUrl: "https://blog.example/feed/",
+		Secret:   "s3cret",
+		State:    websubStatePending,
+	}
+
+	t.Run("subscribe", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(sub))
+		mock.ExpectExec(query("ActivateWebSubSubscription")).
+			WithArgs(sub.FeedID, timeNear{time.Now().Add(time.Hour)}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		target := "/v1/websub/" + sub.FeedID.String() + "?" + url.Values{
+			"hub.mode":          {"subscribe"},
+			"hub.topic":         {sub.TopicUrl},
+			"hub.challenge":     {"c4allenge"},
+			"hub.lease_seconds": {"3600"},
+		}.Encode()
+		req := withURLParams(httptest.NewRequest(http.MethodGet, target, nil), "feedID", sub.FeedID.String())
+		w := httptest.NewRecorder()
+		cfg.websubVerifyHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if got := w.Body.String(); got != "c4allenge" {
+			t.Errorf("body = %q, want the challenge", got)
+		}
+	})
+
+	t.Run("renewal", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		renewing := sub
+		renewing.State = websubStateActive
+		renewing.PendingSecret = sql.NullString{String: "new secret", Valid: true}
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(renewing))
+		// Activating swaps the pending secret in.
+		mock.ExpectExec(query("ActivateWebSubSubscription")).
+			WithArgs(sub.FeedID, timeNear{time.Now().Add(websubLease)}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		target := "/v1/websub/" + sub.FeedID.String() + "?" + url.Values{
+			"hub.mode":      {"subscribe"},
+			"hub.topic":     {sub.TopicUrl},
+			"hub.challenge": {"c4allenge"},
+		}.Encode()
+		req := withURLParams(httptest.NewRequest(http.MethodGet, target, nil), "feedID", sub.FeedID.String())
+		w := httptest.NewRecorder()
+		cfg.websubVerifyHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("unknown topic", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(sub))
+
+		target := "/v1/websub/" + sub.FeedID.String() + "?" + url.Values{
+			"hub.mode":      {"subscribe"},
+			"hub.topic":     {"https://blog.example/feed"},
+			"hub.challenge": {"c4allenge"},
+		}.Encode()
+		req := withURLParams(httptest.NewRequest(http.MethodGet, target, nil), "feedID", sub.FeedID.String())
+		w := httptest.NewRecorder()
+		cfg.websubVerifyHandler(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+		if strings.Contains(w.Body.String(), "c4allenge") {
+			t.Error("challenge echoed for a topic we didn't subscribe to")
+		}
+	})
+}
+
+func TestWebSubPushHandler(t *testing.T) {
+	sub := database.WebsubSubscription{
+		FeedID:   uuid.New(),
+		HubUrl:   "https://hub.example/",
+		TopicUrl: "https://blog.example/feed/",
+		Secret:   "s3cret",
+		State:    websubStateActive,
+	}
+	body := []byte(`<rss><channel><title>Blog</title><link>https://blog.example/</link>
+<item><title>Pushed post</title><link>https://blog.example/pushed</link></item>
+</channel></rss>`)
+	mac := hmac.New(sha256.New, []byte(sub.Secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	push := func(cfg *apiConfig, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/websub/"+sub.FeedID.String(), strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/rss+xml")
+		req.Header.Set("X-Hub-Signature", signature)
+		w := httptest.NewRecorder()
+		cfg.websubPushHandler(w, withURLParams(req, "feedID", sub.FeedID.String()))
+		return w
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		feed := database.Feed{ID: sub.FeedID, Name: "Blog", Url: sub.TopicUrl}
+		post := database.Post{ID: uuid.New(), FeedID: feed.ID, Title: "Pushed post", Url: "https://blog.example/pushed"}
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(sub))
+		mock.ExpectQuery(query("GetFeedByID")).
+			WithArgs(feed.ID).
+			WillReturnRows(modelRows(feed))
+		mock.ExpectExec(query("UpdateFeedMetadata")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(query("CreatePost")).
+			WillReturnRows(modelRows(post))
+		mock.ExpectQuery(query("GetClusterByURL")).
+			WithArgs(post.Url, feed.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"cluster_id"}))
+		mock.ExpectQuery(query("GetFilterRulesForFeed")).
+			WithArgs(feed.ID).
+			WillReturnRows(sqlmock.NewRows(nil))
+		mock.ExpectQuery(query("GetWebhooksForFeed")).
+			WithArgs(feed.ID).
+			WillReturnRows(sqlmock.NewRows(nil))
+
+		events, unsubscribe := cfg.Events.subscribe()
+		defer unsubscribe()
+
+		if w := push(cfg, signature); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+		select {
+		case e := <-events:
+			if e.Post == nil || e.Post.ID != post.ID {
+				t.Errorf("event = %+v, want the pushed post", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("pushed post was never ingested")
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(sub))
+
+		events, unsubscribe := cfg.Events.subscribe()
+		defer unsubscribe()
+
+		forged := hmac.New(sha256.New, []byte("not the secret"))
+		forged.Write(body)
+		if w := push(cfg, "sha256="+hex.EncodeToString(forged.Sum(nil))); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+		select {
+		case e := <-events:
+			t.Errorf("forged push was ingested: %+v", e)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("signed with the pending secret", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		renewing := sub
+		renewing.Secret = "previous secret"
+		renewing.PendingSecret = sql.NullString{String: sub.Secret, Valid: true}
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(renewing))
+		mock.ExpectQuery(query("GetFeedByID")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(sqlmock.NewRows(nil))
+
+		if w := push(cfg, signature); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for mock.ExpectationsWereMet() != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("push signed with the pending secret was never ingested")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("pending subscription", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		pending := sub
+		pending.State = websubStatePending
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(pending))
+
+		if w := push(cfg, "sha256=00"); w.Code != http.StatusAccepted {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+	})
+
+	t.Run("denied subscription", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		denied := sub
+		denied.State = websubStateDenied
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(denied))
+
+		if w := push(cfg, signature); w.Code != http.StatusGone {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusGone)
+		}
+	})
+
+	t.Run("unknown subscription", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(sqlmock.NewRows(nil))
+
+		if w := push(cfg, signature); w.Code != http.StatusGone {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusGone)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		unsigned := sub
+		unsigned.Secret = ""
+		mock.ExpectQuery(query("GetWebSubSubscription")).
+			WithArgs(sub.FeedID).
+			WillReturnRows(modelRows(unsigned))
+		// Only queued for the scraper, and only if it wasn't fetched lately.
+		mock.ExpectExec(query("RequestFeedRefetch")).
+			WithArgs(sub.FeedID, timeNear{time.Now().Add(-websubMinRefetchInterval)}).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		events, unsubscribe := cfg.Events.subscribe()
+		defer unsubscribe()
+
+		if w := push(cfg, ""); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+		select {
+		case e := <-events:
+			t.Errorf("unsigned push was ingested: %+v", e)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestRenewWebSubSubscriptions(t *testing.T) {
+	hub, forms := websubHub(t, httptest.NewTLSServer)
+
+	t.Run("active", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.FeedTransport = hub.Client().Transport
+		cfg.PublicBaseURL = "https://reader.example"
+
+		sub := database.WebsubSubscription{
+			FeedID:         uuid.New(),
+			HubUrl:         hub.URL + "/hub",
+			TopicUrl:       "https://blog.example/feed/",
+			Secret:         "old secret",
+			State:          websubStateActive,
+			LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		}
+		mock.ExpectQuery(query("GetWebSubSubscriptionsToRenew")).
+			WithArgs(timeNear{time.Now().Add(websubRenewBefore)}, timeNear{time.Now().Add(-websubRetryAfter)}, websubRenewBatch).
+			WillReturnRows(modelRows(sub))
+		// The subscription stays active with its secret until the hub
+		// verifies the renewal.
+		var pending string
+		mock.ExpectExec(query("SetWebSubPendingSecret")).
+			WithArgs(sub.FeedID, captureString{&pending}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		cfg.renewWebSubSubscriptions(context.Background())
+
+		form := <-forms
+		if got := form.Get("hub.topic"); got != sub.TopicUrl {
+			t.Errorf("hub.topic = %q, want %q", got, sub.TopicUrl)
+		}
+		if got := form.Get("hub.secret"); got == "" || got == sub.Secret || got != pending {
+			t.Errorf("hub.secret = %q, want the fresh pending secret %q", got, pending)
+		}
+		if got, want := form.Get("hub.lease_seconds"), "864000"; got != want {
+			t.Errorf("hub.lease_seconds = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("active hub unreachable", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.FeedTransport = hub.Client().Transport
+		cfg.PublicBaseURL = "https://reader.example"
+
+		sub := database.WebsubSubscription{
+			FeedID:         uuid.New(),
+			HubUrl:         "https://127.0.0.1:1/hub",
+			TopicUrl:       "https://blog.example/feed/",
+			Secret:         "old secret",
+			State:          websubStateActive,
+			LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		}
+		mock.ExpectQuery(query("GetWebSubSubscriptionsToRenew")).
+			WithArgs(timeNear{time.Now().Add(websubRenewBefore)}, timeNear{time.Now().Add(-websubRetryAfter)}, websubRenewBatch).
+			WillReturnRows(modelRows(sub))
+		mock.ExpectExec(query("SetWebSubPendingSecret")).
+			WithArgs(sub.FeedID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(query("SetWebSubSubscriptionState")).
+			WithArgs(sub.FeedID, websubStateActive, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		cfg.renewWebSubSubscriptions(context.Background())
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.FeedTransport = hub.Client().Transport
+		cfg.PublicBaseURL = "https://reader.example"
+
+		sub := database.WebsubSubscription{
+			FeedID:   uuid.New(),
+			HubUrl:   hub.URL + "/hub",
+			TopicUrl: "https://blog.example/feed/",
+			Secret:   "old secret",
+			State:    websubStateFailed,
+		}
+		mock.ExpectQuery(query("GetWebSubSubscriptionsToRenew")).
+			WithArgs(timeNear{time.Now().Add(websubRenewBefore)}, timeNear{time.Now().Add(-websubRetryAfter)}, websubRenewBatch).
+			WillReturnRows(modelRows(sub))
+		mock.ExpectQuery(query("UpsertWebSubSubscription")).
+			WithArgs(sub.FeedID, timeNear{time.Now()}, timeNear{time.Now()}, sub.HubUrl, sub.TopicUrl, sqlmock.AnyArg(), websubStatePending).
+			WillReturnRows(modelRows(sub))
+
+		cfg.renewWebSubSubscriptions(context.Background())
+
+		if got := (<-forms).Get("hub.mode"); got != "subscribe" {
+			t.Errorf("hub.mode = %q, want subscribe", got)
+		}
+	})
+}